@@ -0,0 +1,285 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/UltimateForm/tcprcon/internal/lineedit"
+	"github.com/UltimateForm/tcprcon/pkg/logger"
+	"github.com/UltimateForm/tcprcon/pkg/rcon"
+)
+
+// executeShell runs the interactive shell. Broadcasts are printed as they arrive while
+// responses are matched to their command by the client
+func executeShell(args []string) {
+	if err := runShell(args); err != nil {
+		logger.Critical.Fatal(err)
+	}
+}
+
+// line is what the shell's reader got for one prompt
+type line struct {
+	text string
+	err  error
+}
+
+// runShell returns instead of exiting so that the connection is closed and the terminal
+// restored before a failure is reported
+func runShell(args []string) error {
+	flags := newTransportFlags("shell")
+	flags.BoolVar(&learnCommandsParam, "learn-commands", false, "run the dialect's help or cvarlist at connect to complete its commands, rcon protocol only")
+	flags.DurationVar(&playersIntervalParam, "players-interval", 0, "how often the player list used for completion is fetched from the server, 0 disables it, rcon protocol only")
+	flags.Parse(args)
+	logger.Setup(uint8(logLevelParam))
+	fullAddress := addressParam + ":" + strconv.Itoa(int(portParam))
+	client, err := connectTransport()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	dialect, err := rcon.LookupDialect(dialectParam)
+	if err != nil {
+		return err
+	}
+	out := newConsole(os.Stdin, os.Stdout, fmt.Sprintf("[%v@%v]#", protocolParam, fullAddress), loadHistory(fullAddress))
+	defer out.Close()
+	if out.Interactive() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		out.SetCompleter(shellCompleter(ctx, client, dialect))
+	}
+	// buffered so that the relay can end after the shell stopped listening
+	lost := make(chan error, 1)
+	if sub, ok := client.(subscriber); ok {
+		broadcasts, _ := sub.Subscribe(rcon.KindFilter(rcon.EventBroadcast), rcon.WithBuffer(256))
+		go func() {
+			for event := range broadcasts {
+				out.Broadcast(render(dialect, event.Packet.BodyStr()))
+			}
+			lost <- sub.Err()
+		}()
+	}
+	// stdin can't be interrupted, so lines are read on request by a goroutine that is
+	// left behind if the connection drops while it waits
+	requests, lines := make(chan struct{}), make(chan line)
+	go func() {
+		for range requests {
+			text, err := out.ReadLine()
+			lines <- line{text, err}
+		}
+	}()
+
+	for {
+		logger.Info.Println("-----STARTING CMD EXCHANGE-----")
+		requests <- struct{}{}
+		var next line
+		select {
+		case next = <-lines:
+		case err := <-lost:
+			return errors.Join(errors.New("error while reading from RCON client"), err)
+		}
+		if errors.Is(next.err, io.EOF) {
+			fmt.Println()
+			return nil
+		}
+		if errors.Is(next.err, lineedit.ErrInterrupted) {
+			continue
+		}
+		if next.err != nil {
+			return next.err
+		}
+		cmd := next.text
+		if len(cmd) == 0 {
+			continue
+		}
+		if cmd == "history" {
+			printHistory(out)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeoutParam)
+		response, err := client.ExecuteMulti(ctx, cmd)
+		cancel()
+		if err != nil {
+			return errors.Join(errors.New("error while reading from RCON client"), err)
+		}
+		out.Response(render(dialect, response))
+	}
+}
+
+// printHistory is the shell's history built-in, it lists the lines entered so far
+func printHistory(out *console) {
+	entries, ok := out.History()
+	if !ok {
+		out.Plain("history is only kept when the shell runs in a terminal")
+		return
+	}
+	var listing strings.Builder
+	for i, entry := range entries {
+		fmt.Fprintf(&listing, "%5d  %v\n", i+1, entry)
+	}
+	out.Plain(listing.String())
+}
+
+// executeExec runs the command given as arguments, prints its response and exits non-zero on failure
+func executeExec(args []string) {
+	flags := newTransportFlags("exec")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: tcprcon exec [flags] <command...>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	logger.Setup(uint8(logLevelParam))
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	confirmEnvPassword = false
+	dialect, err := rcon.LookupDialect(dialectParam)
+	if err != nil {
+		logger.Critical.Fatal(err)
+	}
+	client, err := connectTransport()
+	if err != nil {
+		logger.Critical.Fatal(err)
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), timeoutParam)
+	defer cancel()
+	response, err := client.ExecuteMulti(ctx, strings.Join(flags.Args(), " "))
+	if err != nil {
+		logger.Critical.Fatal(err)
+	}
+	fmt.Println(render(dialect, response))
+}
+
+// executeListen sends the given subscription commands, e.g. "listen chat", then prints
+// broadcasts until interrupted or the connection ends
+func executeListen(args []string) {
+	flags := newTransportFlags("listen")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: tcprcon listen [flags] [subscription command...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	logger.Setup(uint8(logLevelParam))
+	confirmEnvPassword = false
+	dialect, err := rcon.LookupDialect(dialectParam)
+	if err != nil {
+		logger.Critical.Fatal(err)
+	}
+	client, err := connectTransport()
+	if err != nil {
+		logger.Critical.Fatal(err)
+	}
+	defer client.Close()
+	sub, ok := client.(subscriber)
+	if !ok {
+		logger.Critical.Fatalf("the %v protocol doesn't deliver broadcasts", protocolParam)
+	}
+	events, subscription := sub.Subscribe(rcon.KindFilter(rcon.EventBroadcast), rcon.WithBuffer(256))
+	defer subscription.Cancel()
+
+	for _, cmd := range flags.Args() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeoutParam)
+		_, err := client.ExecuteMulti(ctx, cmd)
+		cancel()
+		if err != nil {
+			logger.Critical.Fatal(fmt.Errorf("subscribing with %q: %w", cmd, err))
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				logger.Critical.Fatal(errors.Join(errors.New("connection ended"), sub.Err()))
+			}
+			fmt.Println(render(dialect, event.Packet.BodyStr()))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// executeRun executes the commands of a script, one per line. Blank lines and lines
+// starting with # are skipped, "-" reads the script from stdin
+func executeRun(args []string) {
+	var keepGoing bool
+	flags := newTransportFlags("run")
+	flags.BoolVar(&keepGoing, "keep-going", false, "run the remaining commands after one fails")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: tcprcon run [flags] <script.rcon | ->")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	logger.Setup(uint8(logLevelParam))
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	commands, err := readScript(flags.Arg(0))
+	if err != nil {
+		logger.Critical.Fatal(err)
+	}
+	confirmEnvPassword = false
+	dialect, err := rcon.LookupDialect(dialectParam)
+	if err != nil {
+		logger.Critical.Fatal(err)
+	}
+	client, err := connectTransport()
+	if err != nil {
+		logger.Critical.Fatal(err)
+	}
+	defer client.Close()
+
+	failed := false
+	for _, cmd := range commands {
+		ctx, cancel := context.WithTimeout(context.Background(), timeoutParam)
+		response, err := client.ExecuteMulti(ctx, cmd)
+		cancel()
+		if err != nil {
+			logger.Err.Printf("%q failed: %v", cmd, err)
+			failed = true
+			if !keepGoing {
+				break
+			}
+			continue
+		}
+		fmt.Printf("> %v\n%v\n", cmd, render(dialect, response))
+	}
+	if failed {
+		client.Close()
+		os.Exit(1)
+	}
+}
+
+func readScript(path string) ([]string, error) {
+	var script io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		script = file
+	}
+	var commands []string
+	scanner := bufio.NewScanner(script)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		commands = append(commands, line)
+	}
+	return commands, scanner.Err()
+}
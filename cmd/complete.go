@@ -0,0 +1,275 @@
+package cmd
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/internal/lineedit"
+	"github.com/UltimateForm/tcprcon/pkg/games/mordhau"
+	"github.com/UltimateForm/tcprcon/pkg/logger"
+	"github.com/UltimateForm/tcprcon/pkg/rcon"
+)
+
+var learnCommandsParam bool
+var playersIntervalParam time.Duration
+
+// Completer suggests words for the shell's tab completion. args are the words typed
+// before the one being completed, word is what was typed of it so far
+type Completer interface {
+	Complete(args []string, word string) []string
+}
+
+// commandCatalog lists the commands each dialect's servers are known to have
+var commandCatalog = map[string][]string{
+	"source": {
+		"addip", "banid", "banip", "bot_add", "bot_kick", "changelevel", "cvarlist", "echo", "exec",
+		"find", "help", "kick", "kickid", "listid", "listip", "map", "maps", "mp_restartgame",
+		"mp_timelimit", "quit", "removeid", "removeip", "say", "status", "sv_cheats", "sv_password",
+		"users", "writeid", "writeip",
+	},
+	"rust": {
+		"ban", "banid", "banlistex", "env.time", "global.teleport", "kick", "kickall", "moderatorid",
+		"ownerid", "playerlist", "quit", "removemoderator", "removeowner", "say", "server.save",
+		"server.writecfg", "serverinfo", "status", "unban", "users", "weather.rain",
+	},
+	"minecraft": {
+		"ban", "ban-ip", "banlist", "deop", "difficulty", "effect", "gamemode", "gamerule", "give",
+		"help", "kick", "kill", "list", "msg", "op", "pardon", "pardon-ip", "save-all", "save-off",
+		"save-on", "say", "seed", "setworldspawn", "spawnpoint", "stop", "tell", "time", "title", "tp",
+		"weather", "whitelist", "xp",
+	},
+	"squad": {
+		"AdminBan", "AdminBanById", "AdminBroadcast", "AdminChangeLayer", "AdminDisbandSquad",
+		"AdminEndMatch", "AdminForceTeamChange", "AdminForceTeamChangeById", "AdminKick",
+		"AdminKickById", "AdminListDisconnectedPlayers", "AdminRemovePlayerFromSquad",
+		"AdminRestartMatch", "AdminSetNextLayer", "AdminSlomo", "AdminWarn", "AdminWarnById",
+		"ListCommands", "ListPlayers", "ListSquads", "ShowCurrentMap", "ShowNextMap", "ShowServerInfo",
+	},
+	"mordhau": {
+		"addadmin", "adminlist", "alive", "ban", "banlist", "changelevel", "help", "info", "kick",
+		"listen", "maplist", "mute", "mutelist", "playerlist", "removeadmin", "say", "unban",
+		"unlisten", "unmute",
+	},
+}
+
+// learnCommand is the command whose output lists a dialect's commands, one per line
+var learnCommand = map[string]string{
+	"source":    "cvarlist",
+	"minecraft": "help",
+	"squad":     "ListCommands 1",
+	"mordhau":   "help",
+}
+
+// matching returns the words starting with prefix, ignoring case
+func matching(words []string, prefix string) []string {
+	var matches []string
+	prefix = strings.ToLower(prefix)
+	for _, word := range words {
+		if strings.HasPrefix(strings.ToLower(word), prefix) {
+			matches = append(matches, word)
+		}
+	}
+	return matches
+}
+
+// completers asks each completer in turn, merging their candidates
+type completers []Completer
+
+func (src completers) Complete(args []string, word string) []string {
+	var candidates []string
+	for _, completer := range src {
+		candidates = append(candidates, completer.Complete(args, word)...)
+	}
+	slices.Sort(candidates)
+	return slices.Compact(candidates)
+}
+
+// completeFunc adapts a Completer to the line editor, splitting the line into words
+func completeFunc(completer Completer) lineedit.CompleteFunc {
+	return func(before string) []string {
+		args := strings.Fields(before)
+		word := ""
+		if len(args) > 0 && !strings.HasSuffix(before, " ") {
+			args, word = args[:len(args)-1], args[len(args)-1]
+		}
+		return completer.Complete(args, word)
+	}
+}
+
+// commandCompleter completes the first word from the dialect's catalog and from the
+// commands learned from the server
+type commandCompleter struct {
+	mu       sync.Mutex
+	commands []string
+}
+
+func newCommandCompleter(dialect rcon.Dialect) *commandCompleter {
+	return &commandCompleter{commands: slices.Clone(commandCatalog[dialect.Name])}
+}
+
+func (src *commandCompleter) Complete(args []string, word string) []string {
+	if len(args) > 0 {
+		return nil
+	}
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	return matching(src.commands, word)
+}
+
+var commandName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.\-]+$`)
+
+// Learn adds the command names found at the start of each line of a listing such as
+// the output of "help" or "cvarlist"
+func (src *commandCompleter) Learn(listing string) int {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	learned := 0
+	for line := range strings.SplitSeq(listing, "\n") {
+		name, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(line), "/"), " ")
+		name = strings.TrimRight(name, ":")
+		if !commandName.MatchString(name) || slices.Contains(src.commands, name) {
+			continue
+		}
+		src.commands = append(src.commands, name)
+		learned++
+	}
+	return learned
+}
+
+// learn runs the dialect's listing command, if it has one, and learns its output
+func (src *commandCompleter) learn(ctx context.Context, client rcon.Executor, dialect rcon.Dialect) {
+	command, ok := learnCommand[dialect.Name]
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeoutParam)
+	defer cancel()
+	listing, err := client.ExecuteMulti(ctx, command)
+	if err != nil {
+		logger.Debug.Printf("couldn't learn commands with %q: %v\n", command, err)
+		return
+	}
+	logger.Debug.Printf("learned %v commands from %q\n", src.Learn(listing), command)
+}
+
+// playerCompleter completes arguments with the names and ids of the players online,
+// refreshed periodically from the server
+type playerCompleter struct {
+	mu      sync.Mutex
+	players []string
+	list    func(ctx context.Context, client rcon.Executor) ([]string, error)
+}
+
+// newPlayerCompleter returns nil when there's no known way to list the dialect's players
+func newPlayerCompleter(dialect rcon.Dialect) *playerCompleter {
+	list, ok := playerLists[dialect.Name]
+	if !ok {
+		return nil
+	}
+	return &playerCompleter{list: list}
+}
+
+func (src *playerCompleter) Complete(args []string, word string) []string {
+	if len(args) == 0 {
+		return nil
+	}
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	return matching(src.players, word)
+}
+
+// run refreshes the players every interval until ctx is done
+func (src *playerCompleter) run(ctx context.Context, client rcon.Executor, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		reqCtx, cancel := context.WithTimeout(ctx, timeoutParam)
+		players, err := src.list(reqCtx, client)
+		cancel()
+		if err != nil {
+			logger.Debug.Printf("couldn't refresh players for completion: %v\n", err)
+		} else {
+			src.mu.Lock()
+			src.players = players
+			src.mu.Unlock()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sourceStatusPlayer matches a player line of Source's status, e.g.
+// `#      2 "Gordon"            STEAM_1:0:12345 02:11 45 0 active`
+var sourceStatusPlayer = regexp.MustCompile(`^#\s*\d+\s+(?:\d+\s+)?"(.*)"\s+(\S+)`)
+
+// playerLists fetch the names and ids of the players online for each dialect
+var playerLists = map[string]func(ctx context.Context, client rcon.Executor) ([]string, error){
+	"mordhau": func(ctx context.Context, client rcon.Executor) ([]string, error) {
+		players, err := mordhau.PlayerList(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		var words []string
+		for _, player := range players {
+			words = append(words, player.Name, player.PlayFabID)
+		}
+		return words, nil
+	},
+	"source": func(ctx context.Context, client rcon.Executor) ([]string, error) {
+		status, err := client.ExecuteMulti(ctx, "status")
+		if err != nil {
+			return nil, err
+		}
+		var words []string
+		for line := range strings.SplitSeq(status, "\n") {
+			if match := sourceStatusPlayer.FindStringSubmatch(strings.TrimSpace(line)); match != nil {
+				words = append(words, match[1], match[2])
+			}
+		}
+		return words, nil
+	},
+	"minecraft": func(ctx context.Context, client rcon.Executor) ([]string, error) {
+		// "There are 2 of a max of 20 players online: Steve, Alex"
+		list, err := client.ExecuteMulti(ctx, "list")
+		if err != nil {
+			return nil, err
+		}
+		_, names, _ := strings.Cut(list, ":")
+		var words []string
+		for name := range strings.SplitSeq(names, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				words = append(words, name)
+			}
+		}
+		return words, nil
+	},
+}
+
+// shellCompleter builds the shell's completer for the dialect. Learning commands and
+// refreshing players send commands in the background until ctx is done, so they only run
+// when asked for and over Source RCON, the transport the dialects' commands are meant for
+func shellCompleter(ctx context.Context, client rcon.Executor, dialect rcon.Dialect) Completer {
+	commands := newCommandCompleter(dialect)
+	all := completers{commands}
+	if (learnCommandsParam || playersIntervalParam > 0) && protocolParam != "rcon" {
+		logger.Warn.Printf("command learning and player completion aren't available over %v\n", protocolParam)
+		return all
+	}
+	if learnCommandsParam {
+		go commands.learn(ctx, client, dialect)
+	}
+	if playersIntervalParam > 0 {
+		if players := newPlayerCompleter(dialect); players != nil {
+			go players.run(ctx, client, playersIntervalParam)
+			all = append(all, players)
+		}
+	}
+	return all
+}
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/UltimateForm/tcprcon/internal/ansi"
+	"github.com/UltimateForm/tcprcon/internal/lineedit"
+	"github.com/UltimateForm/tcprcon/internal/term"
+	"github.com/UltimateForm/tcprcon/pkg/logger"
+)
+
+const historySize = 1000
+
+// console serializes shell output so that broadcasts printed while the user types land
+// above the prompt, which is then redrawn
+type console struct {
+	mu        sync.Mutex
+	in        *os.File
+	out       io.Writer
+	prompt    string
+	color     bool
+	prompting bool
+	// editor edits lines in raw mode when both ends are terminals, otherwise lines are
+	// read as they come and the terminal owns the text being typed
+	editor *lineedit.Editor
+	reader *bufio.Reader
+	cooked *term.State
+	closed bool
+}
+
+func newConsole(in *os.File, out *os.File, prompt string, history *lineedit.History) *console {
+	src := &console{
+		in:     in,
+		out:    out,
+		prompt: prompt,
+		color:  !noColorParam && isTerminal(out),
+		reader: bufio.NewReader(in),
+	}
+	if term.IsTerminal(in.Fd()) && term.IsTerminal(out.Fd()) {
+		src.editor = lineedit.New(in, out, history)
+	}
+	return src
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// loadHistory opens the shell history of a server, kept in the user's config directory.
+// When it can't be opened the history only lasts for the session
+func loadHistory(server string) *lineedit.History {
+	dir, err := os.UserConfigDir()
+	if err == nil {
+		name := strings.Map(func(r rune) rune {
+			if r == '.' || r == '-' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+				return r
+			}
+			return '_'
+		}, server)
+		var history *lineedit.History
+		history, err = lineedit.LoadHistory(filepath.Join(dir, "tcprcon", "history", name), historySize)
+		if err == nil {
+			return history
+		}
+	}
+	logger.Warn.Printf("shell history won't be saved: %v\n", err)
+	return lineedit.NewHistory(historySize)
+}
+
+// ReadLine prompts for the next line, edited in raw mode when the console has an editor.
+// Ctrl-C returns lineedit.ErrInterrupted
+func (src *console) ReadLine() (string, error) {
+	if src.editor == nil {
+		src.Prompt()
+		line, _, err := src.reader.ReadLine()
+		src.Submitted()
+		return string(line), err
+	}
+	state, err := term.MakeRaw(src.in.Fd())
+	if err != nil {
+		return "", err
+	}
+	src.mu.Lock()
+	if src.closed {
+		// the shell is leaving while this reader was still starting
+		src.mu.Unlock()
+		term.Restore(src.in.Fd(), state)
+		return "", io.EOF
+	}
+	src.cooked = state
+	src.mu.Unlock()
+	defer src.restore()
+	return src.editor.ReadLine(src.prompt)
+}
+
+// Close leaves raw mode even while a ReadLine is still waiting, and keeps later ones
+// from entering it
+func (src *console) Close() {
+	src.mu.Lock()
+	src.closed = true
+	src.mu.Unlock()
+	src.restore()
+}
+
+func (src *console) restore() {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	if src.cooked != nil {
+		term.Restore(src.in.Fd(), src.cooked)
+		src.cooked = nil
+	}
+}
+
+// Interactive reports whether lines are read with the editor
+func (src *console) Interactive() bool {
+	return src.editor != nil
+}
+
+// SetCompleter enables tab completion, it must be called before the first ReadLine
+func (src *console) SetCompleter(completer Completer) {
+	if src.editor != nil {
+		src.editor.Complete = completeFunc(completer)
+	}
+}
+
+// History returns the lines entered in the editor, false when there's no editor
+func (src *console) History() ([]string, bool) {
+	if src.editor == nil {
+		return nil, false
+	}
+	return src.editor.History().Entries(), true
+}
+
+// Prompt prints the prompt, output arriving until Submitted is printed above it
+func (src *console) Prompt() {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	src.prompting = true
+	fmt.Fprint(src.out, src.prompt)
+}
+
+// Submitted records that the user finished the line, the terminal already moved below it
+func (src *console) Submitted() {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	src.prompting = false
+}
+
+func (src *console) Response(body string) {
+	src.print("OUT: ", ansi.DefaultColor, body)
+}
+
+func (src *console) Broadcast(body string) {
+	src.print("BROADCAST: ", ansi.Cyan, body)
+}
+
+// Plain prints output of the shell itself, without a label
+func (src *console) Plain(body string) {
+	src.print("", ansi.DefaultColor, body)
+}
+
+func (src *console) print(label string, color int, body string) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	body = strings.TrimRight(body, "\n")
+	if src.color && label != "" {
+		label = ansi.Format(label, color, ansi.Bold)
+	}
+	text := fmt.Sprintf("%v%v\n", label, body)
+	if src.editor != nil {
+		src.editor.Print(text)
+		return
+	}
+	if src.prompting {
+		if src.color {
+			fmt.Fprint(src.out, "\r"+ansi.ClearLine)
+		} else {
+			fmt.Fprintln(src.out)
+		}
+	}
+	fmt.Fprint(src.out, text)
+	if src.prompting {
+		fmt.Fprint(src.out, src.prompt)
+	}
+}
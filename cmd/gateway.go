@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/gateway"
+	"github.com/UltimateForm/tcprcon/pkg/logger"
+)
+
+var gatewayConfigParam string
+var gatewayListenParam string
+
+func executeGateway(args []string) {
+	flags := flag.NewFlagSet("gateway", flag.ExitOnError)
+	flags.StringVar(&gatewayConfigParam, "config", "gateway.json", "path to the gateway JSON configuration")
+	flags.StringVar(&gatewayListenParam, "listen", ":8080", "HTTP listen address")
+	flags.UintVar(&logLevelParam, "log", logger.LevelWarning, "sets log level (syslog serverity tiers) for execution")
+	flags.Parse(args)
+	logger.Setup(uint8(logLevelParam))
+
+	config, err := gateway.LoadConfig(gatewayConfigParam)
+	if err != nil {
+		logger.Critical.Fatal(err)
+	}
+	rconGateway, err := gateway.New(config)
+	if err != nil {
+		logger.Critical.Fatal(err)
+	}
+	defer rconGateway.Close()
+
+	httpServer := &http.Server{
+		Addr:    gatewayListenParam,
+		Handler: rconGateway,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+	logger.Info.Printf("serving %v servers on %v", len(config.Servers), gatewayListenParam)
+	err = httpServer.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		logger.Critical.Fatal(err)
+	}
+}
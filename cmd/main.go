@@ -2,16 +2,17 @@ package cmd
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/UltimateForm/tcprcon/pkg/common_rcon"
+	"github.com/UltimateForm/tcprcon/internal/ansi"
 	"github.com/UltimateForm/tcprcon/pkg/logger"
-	"github.com/UltimateForm/tcprcon/pkg/packet"
 	"github.com/UltimateForm/tcprcon/pkg/rcon"
 )
 
@@ -19,12 +20,75 @@ var addressParam string
 var portParam uint
 var passwordParam string
 var logLevelParam uint
+var dialectParam string
+var noColorParam bool
+var protocolParam string
+var timeoutParam time.Duration
 
-func init() {
-	flag.StringVar(&addressParam, "address", "localhost", "RCON address, excluding port")
-	flag.UintVar(&portParam, "port", 7778, "RCON port")
-	flag.StringVar(&passwordParam, "pw", "", "RCON password, if not provided will attempt to load from env variables, if unavailable will prompt")
-	flag.UintVar(&logLevelParam, "log", logger.LevelWarning, "sets log level (syslog serverity tiers) for execution")
+// confirmEnvPassword asks before using the password from the environment, which
+// non-interactive commands can't do
+var confirmEnvPassword = true
+
+// registerConnectionFlags adds the flags shared by every mode that talks to a server
+func registerConnectionFlags(flags *flag.FlagSet) {
+	flags.StringVar(&addressParam, "address", "localhost", "RCON address, excluding port")
+	flags.UintVar(&portParam, "port", 7778, "RCON port")
+	flags.StringVar(&passwordParam, "pw", "", "RCON password, if not provided will attempt to load from env variables, if unavailable will prompt")
+	flags.UintVar(&logLevelParam, "log", logger.LevelWarning, "sets log level (syslog serverity tiers) for execution")
+	flags.StringVar(&dialectParam, "dialect", "source", "server dialect, one of: "+strings.Join(rcon.DialectNames(), ", "))
+	flags.BoolVar(&noColorParam, "no-color", os.Getenv("NO_COLOR") != "", "strip formatting codes from responses instead of rendering them as colors")
+}
+
+// newTransportFlags builds the flag set of a command that talks to a server over any protocol
+func newTransportFlags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	registerConnectionFlags(flags)
+	flags.StringVar(&protocolParam, "protocol", "rcon", "transport protocol, one of: "+strings.Join(protocols, ", "))
+	flags.DurationVar(&timeoutParam, "timeout", 30*time.Second, "timeout for each command")
+	return flags
+}
+
+// render prepares a response body for the terminal according to the dialect's formatting codes
+func render(dialect rcon.Dialect, body string) string {
+	if !dialect.FormatCodes {
+		return body
+	}
+	if noColorParam {
+		return ansi.StripMinecraft(body)
+	}
+	return ansi.TranslateMinecraft(body)
+}
+
+// connect dials and authenticates against the server described by the connection flags
+func connect() (*rcon.Client, error) {
+	fullAddress := addressParam + ":" + strconv.Itoa(int(portParam))
+	password, err := determinePassword()
+	if err != nil {
+		return nil, err
+	}
+	dialect, err := rcon.LookupDialect(dialectParam)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debug.Printf("Dialing %v at port %v\n", addressParam, portParam)
+	client, err := rcon.New(fullAddress, rcon.WithDialect(dialect))
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug.Println("Building auth packet")
+	authCtx, cancelAuth := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancelAuth()
+	authSuccess, err := client.Authenticate(authCtx, password)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	if !authSuccess {
+		client.Close()
+		return nil, errors.New("auth failure")
+	}
+	return client, nil
 }
 
 func determinePassword() (string, error) {
@@ -32,6 +96,9 @@ func determinePassword() (string, error) {
 		return passwordParam, nil
 	}
 	envPassword := os.Getenv("rcon_password")
+	if !confirmEnvPassword {
+		return envPassword, nil
+	}
 	var password string
 	if len(envPassword) > 0 {
 		r := ""
@@ -53,51 +120,29 @@ func determinePassword() (string, error) {
 }
 
 func Execute() {
-	flag.Parse()
-	logger.Setup(uint8(logLevelParam))
-	fullAddress := addressParam + ":" + strconv.Itoa(int(portParam))
-	shell := fmt.Sprintf("[rcon@%v]", fullAddress)
-	password, err := determinePassword()
-	if err != nil {
-		logger.Critical.Fatal(err)
+	command, args := "shell", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
 	}
-	logger.Debug.Printf("Dialing %v at port %v\n", addressParam, portParam)
-	rcon, err := rcon.New(fullAddress)
-	if err != nil {
-		logger.Critical.Fatal(err)
+	switch command {
+	case "shell":
+		executeShell(args)
+	case "exec":
+		executeExec(args)
+	case "listen":
+		executeListen(args)
+	case "run":
+		executeRun(args)
+	case "tui":
+		executeTUI(args)
+	case "proxy":
+		executeProxy(args)
+	case "gateway":
+		executeGateway(args)
+	case "query":
+		executeQuery(args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q, expected one of: shell, exec, listen, run, tui, proxy, gateway, query\n", command)
+		os.Exit(2)
 	}
-	defer rcon.Close()
-
-	logger.Debug.Println("Building auth packet")
-	auhSuccess, authErr := common_rcon.Authenticate(rcon, password)
-	if authErr != nil {
-		logger.Err.Fatal(err)
-	}
-	if !auhSuccess {
-		logger.Err.Fatal(errors.New("auth failure"))
-	}
-	for {
-		logger.Info.Println("-----STARTING CMD EXCHANGE-----")
-		stdinread := bufio.NewReader(os.Stdin)
-		fmt.Printf("%v#", shell)
-		cmd, _, err := stdinread.ReadLine()
-		if err != nil {
-			logger.Critical.Fatal(err)
-		}
-		if string(cmd) != "." {
-			currId := rcon.Id()
-			execPacket := packet.New(currId, packet.SERVERDATA_EXECCOMMAND, cmd)
-			rcon.Write(execPacket.Serialize())
-		} else {
-			logger.Info.Println("Skipping server write")
-		}
-
-		logger.Debug.Println("Reading from server...")
-		responsePkt, err := packet.Read(rcon)
-		if err != nil {
-			logger.Critical.Fatal(errors.Join(errors.New("error while reading from RCON client"), err))
-		}
-		fmt.Printf("OUT: %v\n", responsePkt.BodyStr())
-	}
-
 }
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/logger"
+	"github.com/UltimateForm/tcprcon/pkg/proxy"
+	"github.com/UltimateForm/tcprcon/pkg/rcon"
+)
+
+var proxyListenParam string
+var proxyPasswordsParam string
+
+func executeProxy(args []string) {
+	flags := flag.NewFlagSet("proxy", flag.ExitOnError)
+	registerConnectionFlags(flags)
+	flags.StringVar(&proxyListenParam, "listen", ":7779", "address downstream RCON clients connect to")
+	flags.StringVar(&proxyPasswordsParam, "downstream-pw", "", "comma separated passwords accepted from downstream clients")
+	flags.Parse(args)
+	logger.Setup(uint8(logLevelParam))
+
+	passwords := []string{}
+	for _, password := range strings.Split(proxyPasswordsParam, ",") {
+		if password = strings.TrimSpace(password); password != "" {
+			passwords = append(passwords, password)
+		}
+	}
+	if len(passwords) == 0 {
+		logger.Critical.Fatal("at least one downstream password is required, see -downstream-pw")
+	}
+
+	upstream, err := connect()
+	if err != nil {
+		logger.Critical.Fatal(err)
+	}
+	defer upstream.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go upstream.Keepalive(ctx, rcon.DefaultKeepaliveInterval)
+
+	rconProxy := proxy.New(upstream, passwords...)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		rconProxy.Shutdown(shutdownCtx)
+	}()
+	logger.Info.Printf("proxying %v for downstream clients on %v", upstream.Address, proxyListenParam)
+	err = rconProxy.ListenAndServe(proxyListenParam)
+	switch {
+	case ctx.Err() != nil:
+	case errors.Is(err, proxy.ErrServerClosed):
+		// the proxy closes itself once the upstream connection is gone
+		logger.Warn.Printf("upstream connection to %v ended, stopping the proxy", upstream.Address)
+	default:
+		logger.Critical.Fatal(err)
+	}
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/logger"
+	"github.com/UltimateForm/tcprcon/pkg/query"
+)
+
+var queryPlayersParam bool
+var queryRulesParam bool
+var queryTimeoutParam time.Duration
+
+func executeQuery(args []string) {
+	flags := flag.NewFlagSet("query", flag.ExitOnError)
+	flags.StringVar(&addressParam, "address", "localhost", "server address, excluding port")
+	flags.UintVar(&portParam, "port", 27015, "query port, usually the game port")
+	flags.UintVar(&logLevelParam, "log", logger.LevelWarning, "sets log level (syslog serverity tiers) for execution")
+	flags.BoolVar(&queryPlayersParam, "players", false, "also list players")
+	flags.BoolVar(&queryRulesParam, "rules", false, "also list server rules")
+	flags.DurationVar(&queryTimeoutParam, "timeout", query.DefaultTimeout, "timeout for each request")
+	flags.Parse(args)
+	logger.Setup(uint8(logLevelParam))
+
+	client, err := query.New(net.JoinHostPort(addressParam, strconv.Itoa(int(portParam))))
+	if err != nil {
+		logger.Critical.Fatal(err)
+	}
+	defer client.Close()
+	client.Timeout = queryTimeoutParam
+	ctx := context.Background()
+
+	info, err := client.Info(ctx)
+	if err != nil {
+		logger.Critical.Fatal(err)
+	}
+	out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(out, "Name:\t%v\n", info.Name)
+	fmt.Fprintf(out, "Game:\t%v (%v)\n", info.Game, info.AppID)
+	fmt.Fprintf(out, "Map:\t%v\n", info.Map)
+	fmt.Fprintf(out, "Players:\t%v/%v (%v bots)\n", info.Players, info.MaxPlayers, info.Bots)
+	fmt.Fprintf(out, "Version:\t%v\n", info.Version)
+	fmt.Fprintf(out, "Password:\t%v\n", info.Private)
+	fmt.Fprintf(out, "VAC:\t%v\n", info.VAC)
+	if info.Keywords != "" {
+		fmt.Fprintf(out, "Keywords:\t%v\n", info.Keywords)
+	}
+
+	if queryPlayersParam {
+		players, err := client.Players(ctx)
+		if err != nil {
+			logger.Critical.Fatal(err)
+		}
+		fmt.Fprintf(out, "\nPLAYER\tSCORE\tTIME\n")
+		for _, player := range players {
+			fmt.Fprintf(out, "%v\t%v\t%v\n", player.Name, player.Score, player.Duration.Truncate(time.Second))
+		}
+	}
+
+	if queryRulesParam {
+		rules, err := client.Rules(ctx)
+		if err != nil {
+			logger.Critical.Fatal(err)
+		}
+		names := make([]string, 0, len(rules))
+		for name := range rules {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		fmt.Fprintf(out, "\nRULE\tVALUE\n")
+		for _, name := range names {
+			fmt.Fprintf(out, "%v\t%v\n", name, rules[name])
+		}
+	}
+	out.Flush()
+}
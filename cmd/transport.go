@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/battleye"
+	"github.com/UltimateForm/tcprcon/pkg/logger"
+	"github.com/UltimateForm/tcprcon/pkg/rcon"
+	"github.com/UltimateForm/tcprcon/pkg/telnetcon"
+	"github.com/UltimateForm/tcprcon/pkg/udprcon"
+	"github.com/UltimateForm/tcprcon/pkg/webrcon"
+)
+
+var protocols = []string{"rcon", "telnet", "battleye", "webrcon", "goldsrc", "quake3"}
+
+// transport is what the shell needs from a connection, whatever the protocol
+type transport interface {
+	rcon.Executor
+	Close() error
+}
+
+// subscriber is implemented by transports that deliver output the server sends on its own
+type subscriber interface {
+	rcon.Subscriber
+	Err() error
+}
+
+// connectTransport connects with the protocol picked by the -protocol flag
+func connectTransport() (transport, error) {
+	if protocolParam == "rcon" {
+		return connect()
+	}
+	fullAddress := addressParam + ":" + strconv.Itoa(int(portParam))
+	password, err := determinePassword()
+	if err != nil {
+		return nil, err
+	}
+	authCtx, cancelAuth := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancelAuth()
+	logger.Debug.Printf("Dialing %v at port %v over %v\n", addressParam, portParam, protocolParam)
+
+	var client transport
+	switch protocolParam {
+	case "telnet":
+		client, err = telnetcon.New(fullAddress)
+	case "battleye":
+		client, err = battleye.New(fullAddress)
+	case "webrcon":
+		client, err = webrcon.Dial(authCtx, fullAddress, password)
+	case "goldsrc":
+		client, err = udprcon.New(fullAddress, password, udprcon.FlavorGoldSrc)
+	case "quake3":
+		client, err = udprcon.New(fullAddress, password, udprcon.FlavorQuake3)
+	default:
+		return nil, fmt.Errorf("unknown protocol %q, expected one of: %v", protocolParam, strings.Join(protocols, ", "))
+	}
+	if err != nil {
+		return nil, err
+	}
+	// WebRCON logs in while dialing and connectionless rcon sends the password with every command
+	authenticator, ok := client.(rcon.Authenticator)
+	if !ok {
+		return client, nil
+	}
+	authSuccess, err := authenticator.Authenticate(authCtx, password)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	if !authSuccess {
+		client.Close()
+		return nil, errors.New("auth failure")
+	}
+	return client, nil
+}
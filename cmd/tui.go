@@ -0,0 +1,392 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/UltimateForm/tcprcon/internal/ansi"
+	"github.com/UltimateForm/tcprcon/internal/term"
+	"github.com/UltimateForm/tcprcon/pkg/games/mordhau"
+	"github.com/UltimateForm/tcprcon/pkg/logger"
+	"github.com/UltimateForm/tcprcon/pkg/query"
+	"github.com/UltimateForm/tcprcon/pkg/rcon"
+)
+
+const (
+	tuiHistory = 1000
+	// rows taken by the status bar, the two pane titles and the input line
+	tuiChrome = 4
+)
+
+var tuiQueryPortParam uint
+var tuiStatusIntervalParam time.Duration
+
+// tui draws the full-screen mode: status bar, event pane, output pane and input line
+type tui struct {
+	mu      sync.Mutex
+	width   int
+	height  int
+	events  []string
+	output  []string
+	input   []rune
+	scroll  int
+	server  string
+	online  bool
+	latency time.Duration
+	players int
+	dirty   chan struct{}
+}
+
+func newTUI(server string) *tui {
+	return &tui{server: server, online: true, players: -1, dirty: make(chan struct{}, 1)}
+}
+
+// update changes the state under the lock and schedules a redraw
+func (src *tui) update(fn func()) {
+	src.mu.Lock()
+	fn()
+	src.mu.Unlock()
+	select {
+	case src.dirty <- struct{}{}:
+	default:
+	}
+}
+
+func (src *tui) addEvent(line string) {
+	src.update(func() {
+		src.events = appendHistory(src.events, time.Now().Format("15:04:05")+" "+line)
+	})
+}
+
+func (src *tui) addOutput(lines ...string) {
+	src.update(func() {
+		for _, line := range lines {
+			src.output = appendHistory(src.output, line)
+		}
+	})
+}
+
+func appendHistory(history []string, text string) []string {
+	for line := range strings.SplitSeq(strings.TrimRight(text, "\n"), "\n") {
+		history = append(history, sanitize(line))
+	}
+	if len(history) > tuiHistory {
+		history = history[len(history)-tuiHistory:]
+	}
+	return history
+}
+
+// sanitize drops control characters that would move the cursor out of its pane
+func sanitize(line string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return ' '
+		}
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, line)
+}
+
+// wrap splits lines into rows of at most width runes
+func wrap(lines []string, width int) []string {
+	var rows []string
+	for _, line := range lines {
+		runes := []rune(line)
+		for len(runes) > width {
+			rows = append(rows, string(runes[:width]))
+			runes = runes[width:]
+		}
+		rows = append(rows, string(runes))
+	}
+	return rows
+}
+
+// tail returns the height rows ending skip rows before the last one, padded at the top
+func tail(rows []string, height int, skip int) []string {
+	end := max(len(rows)-skip, 0)
+	start := max(end-height, 0)
+	visible := rows[start:end]
+	for len(visible) < height {
+		visible = append([]string{""}, visible...)
+	}
+	return visible
+}
+
+func (src *tui) title(text string) string {
+	text = "── " + text + " "
+	return ansi.Format(text+strings.Repeat("─", max(src.width-utf8.RuneCountInString(text), 0)), ansi.BrightBlue)
+}
+
+func (src *tui) statusBar() string {
+	state := ansi.Format("● connected", ansi.Green)
+	if !src.online {
+		state = ansi.Format("● disconnected", ansi.Red)
+	}
+	latency, players := "-", "?"
+	if src.latency > 0 {
+		latency = src.latency.Round(time.Millisecond).String()
+	}
+	if src.players >= 0 {
+		players = strconv.Itoa(src.players)
+	}
+	text := fmt.Sprintf(" %v  %v  latency %v  players %v", src.server, state, latency, players)
+	return ansi.Format(text, ansi.Bold)
+}
+
+// frame renders the whole screen, rows are cleared and redrawn from the top
+func (src *tui) frame() string {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	width, height := max(src.width, 10), max(src.height, tuiChrome+2)
+	panes := height - tuiChrome
+	eventRows := panes / 2
+	outputRows := panes - eventRows
+	events := wrap(src.events, width)
+	src.scroll = min(src.scroll, max(len(events)-eventRows, 0))
+
+	rows := []string{src.statusBar(), src.title("events")}
+	rows = append(rows, tail(events, eventRows, src.scroll)...)
+	rows = append(rows, src.title("output"))
+	rows = append(rows, tail(wrap(src.output, width), outputRows, 0)...)
+	input := src.input
+	if len(input) > width-3 {
+		input = input[len(input)-(width-3):]
+	}
+	rows = append(rows, "> "+string(input))
+
+	var out strings.Builder
+	for i, row := range rows {
+		fmt.Fprintf(&out, ansi.CursorToPos, i+1, 1)
+		out.WriteString(ansi.ClearLine + row)
+	}
+	fmt.Fprintf(&out, ansi.CursorToPos, height, 3+len(input))
+	return out.String()
+}
+
+func (src *tui) resize() {
+	width, height, err := term.Size(os.Stdout.Fd())
+	if err != nil {
+		return
+	}
+	src.update(func() {
+		src.width, src.height = width, height
+	})
+}
+
+func executeTUI(args []string) {
+	flags := newTransportFlags("tui")
+	flags.UintVar(&tuiQueryPortParam, "query-port", 0, "A2S query port used for the player count, 0 disables it")
+	flags.DurationVar(&tuiStatusIntervalParam, "status-interval", 10*time.Second, "how often latency and player count are refreshed")
+	flags.Parse(args)
+	logger.Setup(uint8(logLevelParam))
+	if !term.IsTerminal(os.Stdin.Fd()) || !term.IsTerminal(os.Stdout.Fd()) {
+		logger.Critical.Fatal("tui needs an interactive terminal, use shell or exec instead")
+	}
+	dialect, err := rcon.LookupDialect(dialectParam)
+	if err != nil {
+		logger.Critical.Fatal(err)
+	}
+	client, err := connectTransport()
+	if err != nil {
+		logger.Critical.Fatal(err)
+	}
+	defer client.Close()
+
+	oldState, err := term.MakeRaw(os.Stdin.Fd())
+	if err != nil {
+		logger.Critical.Fatal(err)
+	}
+	defer term.Restore(os.Stdin.Fd(), oldState)
+	fmt.Print(ansi.EnterAltScreen + ansi.ClearScreen)
+	defer fmt.Print(ansi.ExitAltScreen)
+	// logs would scribble over the screen
+	logger.Setup(0)
+
+	ui := newTUI(fmt.Sprintf("%v://%v:%v", protocolParam, addressParam, portParam))
+	ui.resize()
+	plain := func(body string) string {
+		if dialect.FormatCodes {
+			return ansi.StripMinecraft(body)
+		}
+		return body
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if sub, ok := client.(subscriber); ok {
+		events, _ := sub.Subscribe(rcon.KindFilter(rcon.EventBroadcast), rcon.WithBuffer(256))
+		go func() {
+			for event := range events {
+				ui.addEvent(plain(event.Packet.BodyStr()))
+			}
+			ui.addEvent(fmt.Sprintf("connection lost: %v", sub.Err()))
+			ui.update(func() { ui.online = false })
+		}()
+	} else {
+		ui.addEvent(fmt.Sprintf("the %v protocol doesn't deliver broadcasts", protocolParam))
+	}
+	go pollStatus(ctx, ui, client, dialect)
+
+	resized := make(chan os.Signal, 1)
+	term.NotifyResize(resized)
+	keys := make(chan []byte)
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- append([]byte(nil), buf[:n]...)
+		}
+	}()
+
+	fmt.Print(ui.frame())
+	for {
+		select {
+		case <-resized:
+			ui.resize()
+		case <-ui.dirty:
+			fmt.Print(ui.frame())
+		case input, ok := <-keys:
+			if !ok || !ui.handleKeys(ctx, input, client, plain) {
+				return
+			}
+		}
+	}
+}
+
+// handleKeys applies raw terminal input, false means the user asked to quit
+func (src *tui) handleKeys(ctx context.Context, input []byte, client transport, plain func(string) string) bool {
+	for len(input) > 0 {
+		switch {
+		case input[0] == 3, input[0] == 4 && len(src.input) == 0:
+			return false
+		case input[0] == '\r', input[0] == '\n':
+			src.mu.Lock()
+			cmd := strings.TrimSpace(string(src.input))
+			src.input = nil
+			src.mu.Unlock()
+			if cmd != "" {
+				go src.run(ctx, client, cmd, plain)
+			}
+			src.update(func() {})
+			input = input[1:]
+		case input[0] == 127, input[0] == 8:
+			src.update(func() {
+				if len(src.input) > 0 {
+					src.input = src.input[:len(src.input)-1]
+				}
+			})
+			input = input[1:]
+		case input[0] == 27:
+			input = src.handleEscape(input)
+		case input[0] < 32:
+			input = input[1:]
+		default:
+			r, size := utf8.DecodeRune(input)
+			src.update(func() { src.input = append(src.input, r) })
+			input = input[size:]
+		}
+	}
+	return true
+}
+
+// handleEscape scrolls the event pane on Page Up/Down and skips other sequences
+func (src *tui) handleEscape(input []byte) []byte {
+	if len(input) < 3 || input[1] != '[' {
+		return input[1:]
+	}
+	end := 2
+	for end < len(input) && (input[end] < 0x40 || input[end] > 0x7E) {
+		end++
+	}
+	if end == len(input) {
+		return nil
+	}
+	switch string(input[2 : end+1]) {
+	case "5~":
+		src.update(func() { src.scroll += max(src.height-tuiChrome, 2) / 2 })
+	case "6~":
+		src.update(func() { src.scroll = max(src.scroll-max(src.height-tuiChrome, 2)/2, 0) })
+	}
+	return input[end+1:]
+}
+
+func (src *tui) run(ctx context.Context, client transport, cmd string, plain func(string) string) {
+	src.addOutput("> " + cmd)
+	ctx, cancel := context.WithTimeout(ctx, timeoutParam)
+	defer cancel()
+	start := time.Now()
+	response, err := client.ExecuteMulti(ctx, cmd)
+	if err != nil {
+		src.addOutput("error: " + err.Error())
+		return
+	}
+	src.update(func() { src.latency = time.Since(start) })
+	src.addOutput(plain(response))
+}
+
+// pollStatus refreshes the connection state, the latency of the dialect's keepalive
+// command and the player count, from A2S when -query-port is set
+func pollStatus(ctx context.Context, ui *tui, client transport, dialect rcon.Dialect) {
+	var a2s *query.Client
+	if tuiQueryPortParam > 0 {
+		var err error
+		a2s, err = query.New(net.JoinHostPort(addressParam, strconv.Itoa(int(tuiQueryPortParam))))
+		if err == nil {
+			defer a2s.Close()
+		}
+	}
+	ticker := time.NewTicker(tuiStatusIntervalParam)
+	defer ticker.Stop()
+	for {
+		if done, ok := client.(interface{ Done() <-chan struct{} }); ok {
+			select {
+			case <-done.Done():
+				ui.update(func() { ui.online = false })
+			default:
+			}
+		}
+		if dialect.KeepaliveCommand != "" {
+			reqCtx, cancel := context.WithTimeout(ctx, timeoutParam)
+			start := time.Now()
+			if _, err := client.ExecuteMulti(reqCtx, dialect.KeepaliveCommand); err == nil {
+				ui.update(func() { ui.latency = time.Since(start) })
+			}
+			cancel()
+		}
+		players := -1
+		reqCtx, cancel := context.WithTimeout(ctx, timeoutParam)
+		switch {
+		case a2s != nil:
+			if info, err := a2s.Info(reqCtx); err == nil {
+				players = info.Players
+			}
+		case dialect.Name == rcon.MordhauDialect.Name:
+			if list, err := mordhau.PlayerList(reqCtx, client); err == nil {
+				players = len(list)
+			}
+		}
+		cancel()
+		if players >= 0 {
+			ui.update(func() { ui.players = players })
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,16 +1,16 @@
 package examples
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"time"
 
 	"github.com/UltimateForm/tcprcon/pkg/common_rcon"
-	"github.com/UltimateForm/tcprcon/pkg/packet"
 	"github.com/UltimateForm/tcprcon/pkg/rcon"
 )
 
-// ControlledClient wraps rcon.Client with mutex protection and command execution.
+// ControlledClient wraps rcon.Client with usage tracking and a simplified command execution.
 // This demonstrates how to safely use RCON in a concurrent context.
 type ControlledClient struct {
 	*rcon.Client
@@ -47,39 +47,23 @@ func (cc *ControlledClient) Authenticate(password string) (bool, error) {
 
 // Execute sends a command and waits for the response with matching packet ID.
 // Returns the response body as a string.
-// Handles ID mismatches by continuing to read until the correct ID is found.
+// Correlation is done by the underlying rcon.Client, so broadcasts and out-of-order
+// packets never end up as the command's output.
 func (cc *ControlledClient) Execute(cmd string) (string, error) {
-	cc.mu.Lock()
-	defer cc.mu.Unlock()
 	defer func() {
+		cc.mu.Lock()
 		cc.lastUsed = time.Now().Unix()
+		cc.mu.Unlock()
 	}()
 
-	writeId := cc.Id()
-
-	// Send command packet
-	execPacket := packet.New(writeId, packet.SERVERDATA_EXECCOMMAND, []byte(cmd))
-	_, err := cc.Write(execPacket.Serialize())
-	if err != nil {
-		return "", errors.Join(errors.New("failed to write command"), err)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	response, err := cc.Client.Execute(ctx, cmd)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "", errors.New("timeout waiting for response")
 	}
-
-	// Read response with timeout
-	deadline := time.Now().Add(30 * time.Second)
-	for {
-		if time.Now().After(deadline) {
-			return "", errors.New("timeout waiting for response")
-		}
-		cc.SetReadDeadline(time.Now().Add(10 * time.Second))
-
-		responsePkt, err := packet.ReadWithId(cc, writeId)
-		if errors.Is(err, packet.ErrPacketIdMismatch) {
-			// Server sent us a broadcast or out-of-order packet; skip it
-			continue
-		}
-		if err != nil {
-			return "", errors.Join(errors.New("failed to read response"), err)
-		}
-		return responsePkt.BodyStr(), nil
+	if err != nil {
+		return "", errors.Join(errors.New("failed to execute command"), err)
 	}
+	return response, nil
 }
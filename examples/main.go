@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/pool"
+	"github.com/UltimateForm/tcprcon/pkg/rcon"
 )
 
 // ExampleControlledClient demonstrates the ControlledClient wrapper.
@@ -31,17 +34,23 @@ func ExampleControlledClient() error {
 	return nil
 }
 
-// ExampleConnectionPool demonstrates the ConnectionPool for managing multiple connections.
+// ExampleConnectionPool demonstrates pool.Pool for managing multiple connections.
 // This is useful when you have many concurrent commands that don't share a single connection.
 func ExampleConnectionPool() error {
-	pool := NewConnectionPool("localhost:7778", "your_password", 5, time.Minute)
-	defer pool.Close()
+	p := pool.New("localhost:7778", "your_password", pool.Config{
+		MaxOpen:     5,
+		MinIdle:     1,
+		MaxIdleTime: time.Minute,
+		PingCommand: rcon.SourceDialect.KeepaliveCommand,
+	})
+	defer p.Close()
 
-	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
 	// Execute a command using a pooled connection
-	err := pool.WithClient(ctx, func(client *ControlledClient) error {
-		response, err := client.Execute("playerlist")
+	err := p.WithClient(ctx, func(client *rcon.Client) error {
+		response, err := client.Execute(ctx, "playerlist")
 		if err != nil {
 			return err
 		}
@@ -76,7 +85,7 @@ func ExampleEventListener() error {
 			fmt.Println("Listener stopped")
 			return nil
 		case event := <-listener.Events:
-			fmt.Printf("Event: %s\n", event)
+			fmt.Printf("Event: %s\n", event.Packet.BodyStr())
 		}
 	}
 }
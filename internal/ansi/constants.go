@@ -3,6 +3,7 @@ package ansi
 const (
 	ClearScreen    = "\033[2J"
 	CursorHome     = "\033[H"
+	ClearLine      = "\033[2K"
 	CursorToPos    = "\033[%d;%dH" // use with fmt.Sprintf, the two ds are for the row and column coordinates
 	EnterAltScreen = "\033[?1049h"
 	ExitAltScreen  = "\033[?1049l"
@@ -0,0 +1,126 @@
+package ansi
+
+import (
+	"strconv"
+	"strings"
+)
+
+// MinecraftCodePrefix introduces a Minecraft formatting code, e.g. §a for green.
+const MinecraftCodePrefix = '§'
+
+var minecraftColors = map[rune]int{
+	'0': 30, '1': 34, '2': 32, '3': 36, '4': 31, '5': 35, '6': 33, '7': 37,
+	'8': 90, '9': 94, 'a': 92, 'b': 96, 'c': 91, 'd': 95, 'e': 93, 'f': 97,
+}
+
+var minecraftStyles = map[rune]int{
+	'l': Bold,
+	'm': 9, // strikethrough
+	'n': 4, // underline
+	'o': 3, // italic
+	'r': Reset,
+}
+
+// TranslateMinecraft replaces § formatting codes with ANSI escapes. Like in game a color code
+// also clears the active styles. Spigot's §x§r§r§g§g§b§b hex colors become 24-bit colors and
+// the obfuscated code §k is dropped.
+func TranslateMinecraft(text string) string {
+	if !strings.ContainsRune(text, MinecraftCodePrefix) {
+		return text
+	}
+	var out strings.Builder
+	runes := []rune(text)
+	formatted := false
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != MinecraftCodePrefix || i+1 == len(runes) {
+			out.WriteRune(runes[i])
+			continue
+		}
+		code := toLower(runes[i+1])
+		if code == 'x' {
+			if hex, ok := minecraftHex(runes[i+2:]); ok {
+				out.WriteString("\033[0;38;2;" + hex + "m")
+				formatted = true
+				i += 13
+				continue
+			}
+		}
+		if color, ok := minecraftColors[code]; ok {
+			out.WriteString("\033[0;" + strconv.Itoa(color) + "m")
+			formatted = true
+			i++
+			continue
+		}
+		if style, ok := minecraftStyles[code]; ok {
+			out.WriteString("\033[" + strconv.Itoa(style) + "m")
+			formatted = style != Reset
+			i++
+			continue
+		}
+		if code == 'k' {
+			i++
+			continue
+		}
+		out.WriteRune(runes[i])
+	}
+	if formatted {
+		out.WriteString("\033[0m")
+	}
+	return out.String()
+}
+
+// StripMinecraft removes § formatting codes, e.g. for output that isn't a terminal.
+func StripMinecraft(text string) string {
+	if !strings.ContainsRune(text, MinecraftCodePrefix) {
+		return text
+	}
+	var out strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != MinecraftCodePrefix || i+1 == len(runes) {
+			out.WriteRune(runes[i])
+			continue
+		}
+		code := toLower(runes[i+1])
+		if code == 'x' {
+			if _, ok := minecraftHex(runes[i+2:]); ok {
+				i += 13
+				continue
+			}
+		}
+		_, color := minecraftColors[code]
+		_, style := minecraftStyles[code]
+		if color || style || code == 'k' {
+			i++
+			continue
+		}
+		out.WriteRune(runes[i])
+	}
+	return out.String()
+}
+
+// minecraftHex reads the six §-prefixed digits following §x and returns them as "r;g;b"
+func minecraftHex(runes []rune) (string, bool) {
+	if len(runes) < 12 {
+		return "", false
+	}
+	digits := make([]rune, 0, 6)
+	for i := 0; i < 12; i += 2 {
+		if runes[i] != MinecraftCodePrefix {
+			return "", false
+		}
+		digits = append(digits, runes[i+1])
+	}
+	value, err := strconv.ParseUint(string(digits), 16, 32)
+	if err != nil {
+		return "", false
+	}
+	return strconv.Itoa(int(value>>16)) + ";" + strconv.Itoa(int(value>>8&0xff)) + ";" + strconv.Itoa(int(value&0xff)), true
+}
+
+func toLower(r rune) rune {
+	if r >= 'A' && r <= 'Z' {
+		return r + 'a' - 'A'
+	}
+	return r
+}
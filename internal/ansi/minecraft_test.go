@@ -0,0 +1,33 @@
+package ansi
+
+import "testing"
+
+func TestTranslateMinecraft(t *testing.T) {
+	cases := map[string]string{
+		"plain":                "plain",
+		"§aonline§r: Steve":    "\033[0;92monline\033[0m: Steve",
+		"§lbold§4red":          "\033[1mbold\033[0;31mred\033[0m",
+		"§x§F§f§8§0§0§0orange": "\033[0;38;2;255;128;0morange\033[0m",
+		"§kmagic§r":            "magic\033[0m",
+		"100§ and §zunknown":   "100§ and §zunknown",
+		"trailing§":            "trailing§",
+	}
+	for in, want := range cases {
+		if got := TranslateMinecraft(in); got != want {
+			t.Fatalf("TranslateMinecraft(%q) mismatch: got %q want %q", in, got, want)
+		}
+	}
+}
+
+func TestStripMinecraft(t *testing.T) {
+	cases := map[string]string{
+		"§6There are §c2§6 of a max of §c20§6 players online: §rSteve, Alex": "There are 2 of a max of 20 players online: Steve, Alex",
+		"§x§F§F§8§0§0§0orange§r":                                             "orange",
+		"100§ and §zunknown":                                                 "100§ and §zunknown",
+	}
+	for in, want := range cases {
+		if got := StripMinecraft(in); got != want {
+			t.Fatalf("StripMinecraft(%q) mismatch: got %q want %q", in, got, want)
+		}
+	}
+}
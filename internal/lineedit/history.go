@@ -0,0 +1,91 @@
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// History keeps entered lines, oldest first, and appends each new one to its file
+type History struct {
+	mu      sync.Mutex
+	path    string
+	max     int
+	entries []string
+}
+
+// LoadHistory reads the history at path, a missing file is an empty history. Only the
+// last max entries are kept, the file is rewritten when it holds more
+func LoadHistory(path string, max int) (*History, error) {
+	history := &History{path: path, max: max}
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return history, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			history.entries = append(history.entries, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(history.entries) > max {
+		history.entries = history.entries[len(history.entries)-max:]
+		data := strings.Join(history.entries, "\n") + "\n"
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			return nil, err
+		}
+	}
+	return history, nil
+}
+
+// NewHistory returns a history that is only kept in memory
+func NewHistory(max int) *History {
+	return &History{max: max}
+}
+
+// Add records a line, skipping blanks and repeats of the previous entry
+func (src *History) Add(line string) error {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	if strings.TrimSpace(line) == "" || strings.ContainsAny(line, "\r\n") {
+		return nil
+	}
+	if len(src.entries) > 0 && src.entries[len(src.entries)-1] == line {
+		return nil
+	}
+	src.entries = append(src.entries, line)
+	if len(src.entries) > src.max {
+		src.entries = src.entries[len(src.entries)-src.max:]
+	}
+	if src.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(src.path), 0o700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(src.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteString(line + "\n")
+	return err
+}
+
+// Entries returns a copy of the history, oldest first
+func (src *History) Entries() []string {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	return append([]string(nil), src.entries...)
+}
@@ -0,0 +1,409 @@
+// Package lineedit is a small emacs-style line editor for terminals in raw mode, with
+// history and reverse incremental search.
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/UltimateForm/tcprcon/internal/ansi"
+)
+
+// ErrInterrupted is returned by ReadLine when the user presses Ctrl-C
+var ErrInterrupted error = errors.New("interrupted")
+
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlG     = 7
+	keyBackspace = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlR     = 18
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyDelete    = 127
+	// escape sequences are mapped past the unicode range
+	keyUp rune = unicode.MaxRune + iota
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyForwardDelete
+	keyUnknown
+)
+
+// CompleteFunc returns the candidates for the word before the cursor, given the line up
+// to the cursor. Candidates are whole words that replace the one being typed
+type CompleteFunc func(before string) []string
+
+// Editor reads lines from in, echoing and redrawing them on out. The terminal must
+// already be in raw mode, output processing can stay on
+type Editor struct {
+	// Complete is called on Tab, it must be set before the first ReadLine
+	Complete CompleteFunc
+
+	in      *bufio.Reader
+	out     io.Writer
+	history *History
+
+	mu      sync.Mutex
+	active  bool
+	prompt  string
+	line    []rune
+	pos     int
+	browse  int    // history entry being shown, len(entries) is the line being typed
+	pending []rune // the line being typed while browsing history
+	search  *search
+}
+
+// search is the state of a Ctrl-R reverse incremental search
+type search struct {
+	query    []rune
+	match    int // index in the history, -1 before anything matched
+	failing  bool
+	original []rune
+}
+
+func New(in io.Reader, out io.Writer, history *History) *Editor {
+	if history == nil {
+		history = NewHistory(1000)
+	}
+	return &Editor{in: bufio.NewReader(in), out: out, history: history}
+}
+
+// History returns the history lines are recorded in
+func (src *Editor) History() *History {
+	return src.history
+}
+
+// ReadLine shows prompt and returns the line once Enter is pressed. Ctrl-C returns
+// ErrInterrupted and Ctrl-D on an empty line returns io.EOF, leaving the cursor after the prompt
+func (src *Editor) ReadLine(prompt string) (string, error) {
+	src.mu.Lock()
+	src.active, src.prompt, src.line, src.pos, src.search = true, prompt, nil, 0, nil
+	src.pending = nil
+	src.browse = len(src.history.Entries())
+	src.refresh()
+	src.mu.Unlock()
+	defer func() {
+		src.mu.Lock()
+		src.active = false
+		src.mu.Unlock()
+	}()
+
+	for {
+		key, err := src.readKey()
+		if err != nil {
+			return "", err
+		}
+		src.mu.Lock()
+		line, done, err := src.handle(key)
+		src.mu.Unlock()
+		if err != nil || done {
+			return line, err
+		}
+	}
+}
+
+// Print writes text above the line being edited, which is then redrawn
+func (src *Editor) Print(text string) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	if src.active {
+		fmt.Fprint(src.out, "\r"+ansi.ClearLine)
+	}
+	fmt.Fprint(src.out, text)
+	if src.active {
+		src.refresh()
+	}
+}
+
+func (src *Editor) readKey() (rune, error) {
+	key, _, err := src.in.ReadRune()
+	if err != nil || key != keyEscape {
+		return key, err
+	}
+	next, _, err := src.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if next != '[' && next != 'O' {
+		return keyUnknown, nil
+	}
+	var params []rune
+	for {
+		r, _, err := src.in.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if r >= 0x40 && r <= 0x7E {
+			return escapeKey(string(params), r), nil
+		}
+		params = append(params, r)
+	}
+}
+
+func escapeKey(params string, final rune) rune {
+	switch final {
+	case 'A':
+		return keyUp
+	case 'B':
+		return keyDown
+	case 'C':
+		return keyRight
+	case 'D':
+		return keyLeft
+	case 'H':
+		return keyHome
+	case 'F':
+		return keyEnd
+	case '~':
+		switch params {
+		case "1", "7":
+			return keyHome
+		case "4", "8":
+			return keyEnd
+		case "3":
+			return keyForwardDelete
+		}
+	}
+	return keyUnknown
+}
+
+// handle applies a key, returning the finished line once it's submitted
+func (src *Editor) handle(key rune) (string, bool, error) {
+	if src.search != nil {
+		if handled, line, done := src.handleSearch(key); handled {
+			return line, done, nil
+		}
+	}
+	switch key {
+	case '\r', '\n':
+		line := string(src.line)
+		fmt.Fprint(src.out, "\n")
+		src.active = false
+		// a history that can't be saved shouldn't cost the user the line
+		src.history.Add(line)
+		return line, true, nil
+	case keyCtrlC:
+		fmt.Fprint(src.out, "^C\n")
+		src.active = false
+		return "", false, ErrInterrupted
+	case keyCtrlD:
+		if len(src.line) == 0 {
+			src.active = false
+			return "", false, io.EOF
+		}
+		src.deleteRange(src.pos, src.pos+1)
+	case keyForwardDelete:
+		src.deleteRange(src.pos, src.pos+1)
+	case keyDelete, keyBackspace:
+		src.deleteRange(src.pos-1, src.pos)
+	case keyCtrlA, keyHome:
+		src.pos = 0
+	case keyCtrlE, keyEnd:
+		src.pos = len(src.line)
+	case keyCtrlB, keyLeft:
+		src.pos = max(src.pos-1, 0)
+	case keyCtrlF, keyRight:
+		src.pos = min(src.pos+1, len(src.line))
+	case keyCtrlU:
+		src.deleteRange(0, src.pos)
+	case keyCtrlK:
+		src.deleteRange(src.pos, len(src.line))
+	case keyCtrlW:
+		start := src.pos
+		for start > 0 && src.line[start-1] == ' ' {
+			start--
+		}
+		for start > 0 && src.line[start-1] != ' ' {
+			start--
+		}
+		src.deleteRange(start, src.pos)
+	case keyCtrlP, keyUp:
+		src.browseHistory(-1)
+	case keyCtrlN, keyDown:
+		src.browseHistory(1)
+	case keyCtrlR:
+		src.search = &search{match: -1, original: src.line}
+	case keyTab:
+		src.complete()
+	default:
+		if !unicode.IsPrint(key) {
+			return "", false, nil
+		}
+		// the line may share its array with a history entry, so it's copied
+		line := make([]rune, 0, len(src.line)+1)
+		line = append(append(append(line, src.line[:src.pos]...), key), src.line[src.pos:]...)
+		src.line = line
+		src.pos++
+	}
+	src.refresh()
+	return "", false, nil
+}
+
+// handleSearch applies a key during reverse search. Keys it doesn't handle accept the
+// match and are then applied to it as usual
+func (src *Editor) handleSearch(key rune) (bool, string, bool) {
+	entries := src.history.Entries()
+	switch {
+	case key == keyCtrlR:
+		from := len(entries) - 1
+		if src.search.match >= 0 {
+			from = src.search.match - 1
+		}
+		src.find(entries, from)
+	case key == keyCtrlG || key == keyCtrlC:
+		src.line, src.pos, src.search = src.search.original, len(src.search.original), nil
+	case key == keyDelete || key == keyBackspace:
+		if len(src.search.query) > 0 {
+			src.search.query = src.search.query[:len(src.search.query)-1]
+			src.find(entries, len(entries)-1)
+		}
+	case key < unicode.MaxRune && unicode.IsPrint(key):
+		src.search.query = append(src.search.query, key)
+		from := len(entries) - 1
+		if src.search.match >= 0 {
+			from = src.search.match
+		}
+		src.find(entries, from)
+	default:
+		src.search = nil
+		return false, "", false
+	}
+	src.refresh()
+	return true, "", false
+}
+
+// find looks for the query from entry from backwards, taking its match as the line
+func (src *Editor) find(entries []string, from int) {
+	query := string(src.search.query)
+	src.search.failing = false
+	if query == "" {
+		src.search.match = -1
+		src.line, src.pos = src.search.original, len(src.search.original)
+		return
+	}
+	for i := min(from, len(entries)-1); i >= 0; i-- {
+		if strings.Contains(entries[i], query) {
+			src.search.match = i
+			src.line = []rune(entries[i])
+			src.pos = len(src.line)
+			return
+		}
+	}
+	src.search.failing = true
+}
+
+// complete replaces the word before the cursor with its only candidate, or with the
+// prefix its candidates share. When that doesn't add anything the candidates are listed
+func (src *Editor) complete() {
+	if src.Complete == nil {
+		return
+	}
+	start := src.pos
+	for start > 0 && src.line[start-1] != ' ' {
+		start--
+	}
+	word := src.line[start:src.pos]
+	candidates := src.Complete(string(src.line[:src.pos]))
+	switch {
+	case len(candidates) == 0:
+		return
+	case len(candidates) == 1:
+		replacement := []rune(candidates[0])
+		if src.pos == len(src.line) {
+			replacement = append(replacement, ' ')
+		}
+		src.replace(start, replacement)
+	default:
+		prefix := commonPrefix(candidates)
+		if len(prefix) > len(word) {
+			src.replace(start, prefix)
+			return
+		}
+		fmt.Fprint(src.out, "\r"+ansi.ClearLine+strings.Join(candidates, "  ")+"\n")
+	}
+}
+
+// replace swaps the text between start and the cursor for text
+func (src *Editor) replace(start int, text []rune) {
+	line := make([]rune, 0, len(src.line)+len(text))
+	line = append(append(append(line, src.line[:start]...), text...), src.line[src.pos:]...)
+	src.line, src.pos = line, start+len(text)
+}
+
+// commonPrefix is the longest prefix all candidates share, ignoring case
+func commonPrefix(candidates []string) []rune {
+	prefix := []rune(candidates[0])
+	for _, candidate := range candidates[1:] {
+		runes := []rune(candidate)
+		n := 0
+		for n < len(prefix) && n < len(runes) && unicode.ToLower(prefix[n]) == unicode.ToLower(runes[n]) {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	return prefix
+}
+
+func (src *Editor) browseHistory(step int) {
+	entries := src.history.Entries()
+	next := src.browse + step
+	if next < 0 || next > len(entries) {
+		return
+	}
+	if src.browse == len(entries) {
+		src.pending = src.line
+	}
+	src.browse = next
+	if next == len(entries) {
+		src.line = src.pending
+	} else {
+		src.line = []rune(entries[next])
+	}
+	src.pos = len(src.line)
+}
+
+func (src *Editor) deleteRange(from, to int) {
+	from, to = max(from, 0), min(to, len(src.line))
+	if from >= to {
+		return
+	}
+	src.line = append(src.line[:from:from], src.line[to:]...)
+	src.pos = from
+}
+
+// refresh redraws the prompt and line, leaving the cursor at the editing position
+func (src *Editor) refresh() {
+	var out strings.Builder
+	out.WriteString("\r" + ansi.ClearLine)
+	if src.search != nil {
+		label := "reverse-i-search"
+		if src.search.failing {
+			label = "failing " + label
+		}
+		fmt.Fprintf(&out, "(%v)`%v': %v", label, string(src.search.query), string(src.line))
+		src.out.Write([]byte(out.String()))
+		return
+	}
+	out.WriteString(src.prompt + string(src.line))
+	if back := len(src.line) - src.pos; back > 0 {
+		fmt.Fprintf(&out, "\033[%dD", back)
+	}
+	src.out.Write([]byte(out.String()))
+}
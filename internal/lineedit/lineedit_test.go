@@ -0,0 +1,170 @@
+package lineedit
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func readLine(t *testing.T, history *History, input string) (string, error) {
+	t.Helper()
+	var out strings.Builder
+	return New(strings.NewReader(input), &out, history).ReadLine("> ")
+}
+
+func TestReadLineEditing(t *testing.T) {
+	cases := map[string]string{
+		"wrld\x01hello \x05!\r":         "hello wrld!",
+		"kick bob\x17joe\r":             "kick joe",
+		"say oops\x15say hi\r":          "say hi",
+		"ab\x1b[Dx\x1b[C\x1b[Cy\r":      "axby",
+		"abc\x1b[H\x1b[3~\x1b[F\x7fZ\r": "bZ",
+		"ban bob now\x02\x02\x02\x0b\r": "ban bob ",
+		"héllo\x08\x08\r":               "hél",
+	}
+	for input, want := range cases {
+		got, err := readLine(t, nil, input)
+		if err != nil {
+			t.Fatalf("ReadLine(%q) failed: %v", input, err)
+		}
+		if got != want {
+			t.Fatalf("line mismatch for %q: got %q want %q", input, got, want)
+		}
+	}
+}
+
+func TestReadLineEndings(t *testing.T) {
+	if _, err := readLine(t, nil, "\x04"); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF on Ctrl-D, got %v", err)
+	}
+	if _, err := readLine(t, nil, "status\x03"); !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("expected ErrInterrupted on Ctrl-C, got %v", err)
+	}
+	if _, err := readLine(t, nil, "status"); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF when input ends, got %v", err)
+	}
+}
+
+func TestReadLineHistory(t *testing.T) {
+	cases := map[string]string{
+		"\x1b[A\r":                 "playerlist",
+		"\x1b[A\x1b[A\x1b[A\r":     "status",
+		"kick\x1b[A\x1b[B\r":       "kick",
+		"\x10\x10\x0e\r":           "playerlist",
+		"\x1b[A\x7f\x7f\x7f\x7f\r": "player",
+	}
+	for input, want := range cases {
+		history := NewHistory(10)
+		history.Add("status")
+		history.Add("playerlist")
+		got, err := readLine(t, history, input)
+		if err != nil {
+			t.Fatalf("ReadLine(%q) failed: %v", input, err)
+		}
+		if got != want {
+			t.Fatalf("line mismatch for %q: got %q want %q", input, got, want)
+		}
+		// editing a recalled entry must not change the history it came from
+		entries := history.Entries()
+		if !slices.Equal(entries[:2], []string{"status", "playerlist"}) || entries[len(entries)-1] != want {
+			t.Fatalf("history mismatch for %q: got %q", input, entries)
+		}
+	}
+}
+
+func TestReadLineReverseSearch(t *testing.T) {
+	cases := map[string]string{
+		"\x12kick\r":               "kick bob",
+		"\x12kick\x12\r":           "kick alice",
+		"say\x12zzz\x7f\x7f\x7f\r": "say",
+		"abc\x12kick\x07\r":        "abc",
+		"\x12stat\x05us\r":         "statusus",
+	}
+	for input, want := range cases {
+		history := NewHistory(10)
+		for _, line := range []string{"kick alice", "status", "kick bob", "say hi"} {
+			history.Add(line)
+		}
+		got, err := readLine(t, history, input)
+		if err != nil {
+			t.Fatalf("ReadLine(%q) failed: %v", input, err)
+		}
+		if got != want {
+			t.Fatalf("line mismatch for %q: got %q want %q", input, got, want)
+		}
+	}
+}
+
+func TestReadLineCompletion(t *testing.T) {
+	complete := func(before string) []string {
+		words := strings.Fields(before)
+		if len(words) == 0 || strings.HasSuffix(before, " ") {
+			words = append(words, "")
+		}
+		var candidates []string
+		for _, candidate := range []string{"kick", "kickall", "KickPlayer", "say", "Bob", "Bobby"} {
+			if strings.HasPrefix(strings.ToLower(candidate), strings.ToLower(words[len(words)-1])) {
+				candidates = append(candidates, candidate)
+			}
+		}
+		return candidates
+	}
+	cases := map[string]string{
+		"sa\t\r":        "say ",
+		"k\t\r":         "kick",
+		"kickp\tbob\r":  "KickPlayer bob",
+		"kick bobb\t\r": "kick Bobby ",
+		"zz\t\r":        "zz",
+		"s\x01k\t\r":    "kicks",
+		"x\x01sa\t\r":   "sayx",
+	}
+	for input, want := range cases {
+		var out strings.Builder
+		editor := New(strings.NewReader(input), &out, nil)
+		editor.Complete = complete
+		got, err := editor.ReadLine("> ")
+		if err != nil {
+			t.Fatalf("ReadLine(%q) failed: %v", input, err)
+		}
+		if got != want {
+			t.Fatalf("line mismatch for %q: got %q want %q", input, got, want)
+		}
+	}
+	// a second Tab that can't extend the word lists the candidates
+	var out strings.Builder
+	editor := New(strings.NewReader("kick b\t\t\r"), &out, nil)
+	editor.Complete = complete
+	if _, err := editor.ReadLine("> "); err != nil {
+		t.Fatalf("ReadLine failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Bob  Bobby\n") {
+		t.Fatalf("expected the candidates to be listed, got %q", out.String())
+	}
+}
+
+func TestHistoryPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "history")
+	history, err := LoadHistory(path, 3)
+	if err != nil {
+		t.Fatalf("LoadHistory failed: %v", err)
+	}
+	for _, line := range []string{"a", "b", "b", " ", "c", "d"} {
+		if err := history.Add(line); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	want := []string{"b", "c", "d"}
+	if got := history.Entries(); !slices.Equal(got, want) {
+		t.Fatalf("entries mismatch: got %q want %q", got, want)
+	}
+	reloaded, err := LoadHistory(path, 3)
+	if err != nil {
+		t.Fatalf("LoadHistory failed: %v", err)
+	}
+	if got := reloaded.Entries(); !slices.Equal(got, want) {
+		t.Fatalf("reloaded entries mismatch: got %q want %q", got, want)
+	}
+}
@@ -0,0 +1,12 @@
+// Package term puts terminals in raw mode and reports their size using plain syscalls.
+// Unix systems are supported, elsewhere every call fails with ErrUnsupported.
+package term
+
+import "errors"
+
+var ErrUnsupported error = errors.New("terminal control is not supported on this platform")
+
+// State is a terminal's configuration as saved by MakeRaw, to be handed back to Restore.
+type State struct {
+	state state
+}
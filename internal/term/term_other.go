@@ -0,0 +1,26 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package term
+
+import "os"
+
+type state struct{}
+
+func IsTerminal(fd uintptr) bool {
+	return false
+}
+
+func MakeRaw(fd uintptr) (*State, error) {
+	return nil, ErrUnsupported
+}
+
+func Restore(fd uintptr, old *State) error {
+	return ErrUnsupported
+}
+
+func Size(fd uintptr) (int, int, error) {
+	return 0, 0, ErrUnsupported
+}
+
+// NotifyResize does nothing, resizes can't be observed on this platform.
+func NotifyResize(ch chan<- os.Signal) {}
@@ -0,0 +1,24 @@
+package term
+
+import (
+	"os"
+	"testing"
+)
+
+func TestPipeIsNotATerminal(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	defer writer.Close()
+	if IsTerminal(reader.Fd()) {
+		t.Fatal("expected a pipe not to be a terminal")
+	}
+	if _, err := MakeRaw(reader.Fd()); err == nil {
+		t.Fatal("expected MakeRaw to fail on a pipe")
+	}
+	if _, _, err := Size(reader.Fd()); err == nil {
+		t.Fatal("expected Size to fail on a pipe")
+	}
+}
@@ -0,0 +1,72 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package term
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+type state struct {
+	termios syscall.Termios
+}
+
+type winsize struct {
+	Row    uint16
+	Col    uint16
+	Xpixel uint16
+	Ypixel uint16
+}
+
+func ioctl(fd uintptr, request uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func IsTerminal(fd uintptr) bool {
+	var termios syscall.Termios
+	return ioctl(fd, ioctlGetTermios, unsafe.Pointer(&termios)) == nil
+}
+
+// MakeRaw disables echo, line buffering and signal keys like cfmakeraw(3), output
+// processing is left on so "\n" still returns the carriage.
+func MakeRaw(fd uintptr) (*State, error) {
+	var termios syscall.Termios
+	if err := ioctl(fd, ioctlGetTermios, unsafe.Pointer(&termios)); err != nil {
+		return nil, err
+	}
+	old := &State{state{termios: termios}}
+	termios.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	termios.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	termios.Cflag &^= syscall.CSIZE | syscall.PARENB
+	termios.Cflag |= syscall.CS8
+	termios.Cc[syscall.VMIN] = 1
+	termios.Cc[syscall.VTIME] = 0
+	if err := ioctl(fd, ioctlSetTermios, unsafe.Pointer(&termios)); err != nil {
+		return nil, err
+	}
+	return old, nil
+}
+
+func Restore(fd uintptr, old *State) error {
+	return ioctl(fd, ioctlSetTermios, unsafe.Pointer(&old.state.termios))
+}
+
+// Size returns the terminal's width and height in cells.
+func Size(fd uintptr) (int, int, error) {
+	var size winsize
+	if err := ioctl(fd, syscall.TIOCGWINSZ, unsafe.Pointer(&size)); err != nil {
+		return 0, 0, err
+	}
+	return int(size.Col), int(size.Row), nil
+}
+
+// NotifyResize sends on ch whenever the terminal is resized (SIGWINCH).
+func NotifyResize(ch chan<- os.Signal) {
+	signal.Notify(ch, syscall.SIGWINCH)
+}
@@ -0,0 +1,135 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Dial opens a websocket to a ws:// or wss:// URL.
+func Dial(ctx context.Context, rawURL string) (*Conn, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host := target.Host
+	if target.Port() == "" {
+		port := "80"
+		if target.Scheme == "wss" {
+			port = "443"
+		}
+		host = net.JoinHostPort(target.Hostname(), port)
+	}
+	var dialer net.Dialer
+	var con net.Conn
+	switch target.Scheme {
+	case "ws":
+		con, err = dialer.DialContext(ctx, "tcp", host)
+	case "wss":
+		tlsDialer := tls.Dialer{NetDialer: &dialer, Config: &tls.Config{ServerName: target.Hostname()}}
+		con, err = tlsDialer.DialContext(ctx, "tcp", host)
+	default:
+		return nil, fmt.Errorf("%w: unsupported scheme %q", ErrHandshake, target.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ws, err := handshake(ctx, con, target)
+	if err != nil {
+		con.Close()
+		return nil, err
+	}
+	return ws, nil
+}
+
+func handshake(ctx context.Context, con net.Conn, target *url.URL) (*Conn, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		con.SetDeadline(deadline)
+		defer con.SetDeadline(time.Time{})
+	}
+	stop := context.AfterFunc(ctx, func() {
+		con.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	key := newKey()
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        target,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Host:       target.Host,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+	}
+	if err := req.Write(con); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(con)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("%w: server answered %v", ErrHandshake, resp.Status)
+	}
+	if !headerContains(resp.Header, "Upgrade", "websocket") || resp.Header.Get("Sec-WebSocket-Accept") != Accept(key) {
+		return nil, fmt.Errorf("%w: invalid upgrade response", ErrHandshake)
+	}
+	return newConn(con, br, true), nil
+}
+
+// Upgrade completes the server side of the handshake and takes over the connection.
+// On failure an error response has already been written.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || key == "" ||
+		!headerContains(r.Header, "Upgrade", "websocket") ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" {
+		http.Error(w, "websocket upgrade required", http.StatusBadRequest)
+		return nil, ErrHandshake
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket upgrade unsupported", http.StatusInternalServerError)
+		return nil, ErrHandshake
+	}
+	con, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %v\r\n\r\n", Accept(key))
+	if err := rw.Flush(); err != nil {
+		con.Close()
+		return nil, err
+	}
+	return newConn(con, rw.Reader, false), nil
+}
+
+// headerContains reports whether a comma separated header holds token, ignoring case
+func headerContains(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for part := range strings.SplitSeq(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,263 @@
+// Package websocket is a minimal RFC 6455 implementation: the opening handshake for both
+// ends, framing with fragmentation, automatic pong replies and the closing handshake.
+// Extensions and subprotocols are not supported.
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	OpContinuation byte = 0x0
+	OpText         byte = 0x1
+	OpBinary       byte = 0x2
+	OpClose        byte = 0x8
+	OpPing         byte = 0x9
+	OpPong         byte = 0xA
+
+	CloseNormal     uint16 = 1000
+	CloseGoingAway  uint16 = 1001
+	CloseProtocol   uint16 = 1002
+	CloseNoStatus   uint16 = 1005
+	CloseTooLarge   uint16 = 1009
+	DefaultMaxBytes        = 16 << 20
+
+	acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+var (
+	ErrHandshake       error = errors.New("websocket handshake failed")
+	ErrProtocol        error = errors.New("websocket protocol violation")
+	ErrMessageTooLarge error = errors.New("websocket message too large")
+	ErrClosed          error = errors.New("websocket closed")
+)
+
+// CloseError is returned by ReadMessage once the peer sent a close frame.
+type CloseError struct {
+	Code uint16
+	Text string
+}
+
+func (src *CloseError) Error() string {
+	return fmt.Sprintf("websocket closed by peer: %v %v", src.Code, src.Text)
+}
+
+func (src *CloseError) Is(target error) bool {
+	return target == ErrClosed
+}
+
+// Conn is a websocket connection. One goroutine may read while others write.
+type Conn struct {
+	// MaxBytes caps the size of a reassembled message, 0 means DefaultMaxBytes
+	MaxBytes int
+
+	con       net.Conn
+	br        *bufio.Reader
+	client    bool
+	writeMu   sync.Mutex
+	closeSent atomic.Bool
+}
+
+func newConn(con net.Conn, br *bufio.Reader, client bool) *Conn {
+	return &Conn{con: con, br: br, client: client}
+}
+
+// Accept computes the Sec-WebSocket-Accept value for a Sec-WebSocket-Key.
+func Accept(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func newKey() string {
+	key := make([]byte, 16)
+	rand.Read(key)
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func (src *Conn) NetConn() net.Conn {
+	return src.con
+}
+
+// ReadMessage returns the next text or binary message, reassembling fragments. Pings are
+// answered on the way, a close frame is answered and reported as a *CloseError.
+func (src *Conn) ReadMessage() (byte, []byte, error) {
+	limit := src.MaxBytes
+	if limit <= 0 {
+		limit = DefaultMaxBytes
+	}
+	var opcode byte
+	var message []byte
+	for {
+		fin, op, payload, err := src.readFrame(limit)
+		if err != nil {
+			return 0, nil, err
+		}
+		switch op {
+		case OpPing:
+			if err := src.WriteMessage(OpPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case OpPong:
+			continue
+		case OpClose:
+			closeErr := &CloseError{Code: CloseNoStatus}
+			if len(payload) >= 2 {
+				closeErr.Code = binary.BigEndian.Uint16(payload)
+				closeErr.Text = string(payload[2:])
+			}
+			src.writeClose(closeErr.Code, "")
+			src.con.Close()
+			return 0, nil, closeErr
+		case OpContinuation:
+			if opcode == 0 {
+				return 0, nil, src.fail(fmt.Errorf("%w: continuation without a message", ErrProtocol))
+			}
+		case OpText, OpBinary:
+			if opcode != 0 {
+				return 0, nil, src.fail(fmt.Errorf("%w: new message inside a fragmented one", ErrProtocol))
+			}
+			opcode = op
+		default:
+			return 0, nil, src.fail(fmt.Errorf("%w: unknown opcode %v", ErrProtocol, op))
+		}
+		if len(message)+len(payload) > limit {
+			src.writeClose(CloseTooLarge, "")
+			src.con.Close()
+			return 0, nil, ErrMessageTooLarge
+		}
+		message = append(message, payload...)
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+func (src *Conn) readFrame(limit int) (bool, byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(src.br, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := head[0]&0x80 != 0
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, src.fail(fmt.Errorf("%w: reserved bits set", ErrProtocol))
+	}
+	opcode := head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+	if masked == src.client {
+		return false, 0, nil, src.fail(fmt.Errorf("%w: unexpected masking", ErrProtocol))
+	}
+	size := uint64(head[1] & 0x7F)
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(src.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(src.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	if opcode >= OpClose && (!fin || size > 125) {
+		return false, 0, nil, src.fail(fmt.Errorf("%w: invalid control frame", ErrProtocol))
+	}
+	if size > uint64(limit) {
+		src.writeClose(CloseTooLarge, "")
+		src.con.Close()
+		return false, 0, nil, ErrMessageTooLarge
+	}
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(src.br, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(src.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteMessage sends payload as a single frame, client frames are masked.
+func (src *Conn) WriteMessage(opcode byte, payload []byte) error {
+	if opcode != OpClose && src.closeSent.Load() {
+		return ErrClosed
+	}
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|opcode)
+	maskBit := byte(0)
+	if src.client {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, maskBit|byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	if src.client {
+		var mask [4]byte
+		rand.Read(mask[:])
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := range payload {
+			frame[start+i] ^= mask[i%4]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	src.writeMu.Lock()
+	defer src.writeMu.Unlock()
+	_, err := src.con.Write(frame)
+	return err
+}
+
+func (src *Conn) Ping(payload []byte) error {
+	return src.WriteMessage(OpPing, payload)
+}
+
+func (src *Conn) writeClose(code uint16, text string) error {
+	if !src.closeSent.CompareAndSwap(false, true) {
+		return nil
+	}
+	payload := binary.BigEndian.AppendUint16(nil, code)
+	return src.WriteMessage(OpClose, append(payload, text...))
+}
+
+func (src *Conn) fail(err error) error {
+	src.writeClose(CloseProtocol, "")
+	src.con.Close()
+	return err
+}
+
+// Close sends a normal close frame and closes the connection without waiting for the
+// peer's reply.
+func (src *Conn) Close() error {
+	src.writeClose(CloseNormal, "")
+	return src.con.Close()
+}
@@ -0,0 +1,165 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newEchoServer(t *testing.T, handle func(*Conn)) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		handle(ws)
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func echo(ws *Conn) {
+	defer ws.Close()
+	for {
+		opcode, message, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := ws.WriteMessage(opcode, message); err != nil {
+			return
+		}
+	}
+}
+
+func dial(t *testing.T, url string) *Conn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ws, err := Dial(ctx, url)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+func TestAccept(t *testing.T) {
+	// the example from RFC 6455 section 1.3
+	if got := Accept("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("accept mismatch: got %q want %q", got, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=")
+	}
+}
+
+func TestEcho(t *testing.T) {
+	ws := dial(t, newEchoServer(t, echo))
+	for _, size := range []int{0, 5, 125, 126, 70000} {
+		message := strings.Repeat("x", size)
+		if err := ws.WriteMessage(OpText, []byte(message)); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		opcode, got, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		if opcode != OpText || string(got) != message {
+			t.Fatalf("echo mismatch for %v bytes: got opcode %v and %v bytes", size, opcode, len(got))
+		}
+	}
+}
+
+func TestFragmentedMessageAndPing(t *testing.T) {
+	pong := make(chan string, 1)
+	url := newEchoServer(t, func(ws *Conn) {
+		defer ws.Close()
+		// a ping may be interleaved between fragments
+		ws.con.Write([]byte{0x01, 3, 'h', 'e', 'l'})
+		ws.con.Write([]byte{0x89, 2, 'h', 'i'})
+		ws.con.Write([]byte{0x80, 2, 'l', 'o'})
+		// readFrame leaves control frames to the caller
+		_, opcode, payload, err := ws.readFrame(DefaultMaxBytes)
+		if err == nil && opcode == OpPong {
+			pong <- string(payload)
+		}
+		ws.ReadMessage()
+	})
+	ws := dial(t, url)
+	opcode, message, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if opcode != OpText || string(message) != "hello" {
+		t.Fatalf("message mismatch: got %v %q want %q", opcode, message, "hello")
+	}
+	select {
+	case payload := <-pong:
+		if payload != "hi" {
+			t.Fatalf("pong payload mismatch: got %q want %q", payload, "hi")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ping was not answered")
+	}
+}
+
+func TestCloseHandshake(t *testing.T) {
+	url := newEchoServer(t, func(ws *Conn) {
+		ws.writeClose(CloseGoingAway, "restarting")
+		ws.ReadMessage()
+	})
+	ws := dial(t, url)
+	_, _, err := ws.ReadMessage()
+	var closeErr *CloseError
+	if !errors.As(err, &closeErr) {
+		t.Fatalf("expected a CloseError, got %v", err)
+	}
+	if closeErr.Code != CloseGoingAway || closeErr.Text != "restarting" {
+		t.Fatalf("close mismatch: got %v %q", closeErr.Code, closeErr.Text)
+	}
+	if !errors.Is(err, ErrClosed) {
+		t.Fatal("expected CloseError to match ErrClosed")
+	}
+	if err := ws.WriteMessage(OpText, []byte("late")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestRejectsUnmaskedClientFrames(t *testing.T) {
+	result := make(chan error, 1)
+	url := newEchoServer(t, func(ws *Conn) {
+		_, _, err := ws.ReadMessage()
+		result <- err
+	})
+	ws := dial(t, url)
+	ws.con.Write([]byte{0x81, 2, 'h', 'i'})
+	select {
+	case err := <-result:
+		if !errors.Is(err, ErrProtocol) {
+			t.Fatalf("expected ErrProtocol, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not reject the frame")
+	}
+}
+
+func TestMessageTooLarge(t *testing.T) {
+	ws := dial(t, newEchoServer(t, echo))
+	ws.MaxBytes = 10
+	ws.WriteMessage(OpText, []byte(strings.Repeat("x", 11)))
+	if _, _, err := ws.ReadMessage(); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("expected ErrMessageTooLarge, got %v", err)
+	}
+}
+
+func TestDialRejectsPlainHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")); !errors.Is(err, ErrHandshake) {
+		t.Fatalf("expected ErrHandshake, got %v", err)
+	}
+}
@@ -0,0 +1,356 @@
+package battleye
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/logger"
+	"github.com/UltimateForm/tcprcon/pkg/packet"
+	"github.com/UltimateForm/tcprcon/pkg/rcon"
+)
+
+const (
+	// servers drop clients that sent nothing for 45 seconds
+	DefaultKeepaliveInterval = 30 * time.Second
+	maxDatagram              = 65535
+	// server messages are resent until acknowledged, about every second for up to 10 seconds.
+	// Sequence numbers wrap after 256 messages, so a repeat must also not be ahead of the last one
+	messageDedupeWindow = 10 * time.Second
+)
+
+var (
+	ErrClientClosed       error = errors.New("battleye client closed")
+	ErrTooManyPending     error = errors.New("all 256 command sequence numbers are in use")
+	ErrConnectionTimedOut error = errors.New("battleye server stopped answering")
+	ErrNotLoggedIn        error = errors.New("battleye client is not logged in")
+)
+
+var (
+	_ rcon.Executor      = (*Client)(nil)
+	_ rcon.Subscriber    = (*Client)(nil)
+	_ rcon.Authenticator = (*Client)(nil)
+)
+
+type pendingCommand struct {
+	parts    [][]byte
+	received int
+	done     chan []byte
+}
+
+// Client is a BattlEye RCon connection. Like rcon.Client, any number of goroutines may
+// Execute concurrently and server messages are delivered through Subscribe.
+type Client struct {
+	Address string
+	// KeepaliveInterval is how often an empty command is sent while idle, set it before Authenticate
+	KeepaliveInterval time.Duration
+
+	con      net.Conn
+	writeMu  sync.Mutex
+	mu       sync.Mutex
+	seq      byte
+	pending  map[byte]*pendingCommand
+	messages map[byte]time.Time
+	lastMsg  int // sequence of the newest accepted message, -1 before the first
+	login    chan bool
+	loggedIn atomic.Bool
+	lastSent atomic.Int64
+	lastRecv atomic.Int64
+
+	events    *rcon.EventHub
+	closeOnce sync.Once
+	closed    atomic.Bool
+	done      chan struct{}
+	err       error
+}
+
+// New dials address over UDP, the client must then Authenticate.
+func New(address string) (*Client, error) {
+	con, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromConn(address, con), nil
+}
+
+// NewFromConn builds a client on top of a connected packet connection and starts reading from it.
+func NewFromConn(address string, con net.Conn) *Client {
+	client := &Client{
+		Address:           address,
+		KeepaliveInterval: DefaultKeepaliveInterval,
+		con:               con,
+		pending:           make(map[byte]*pendingCommand),
+		messages:          make(map[byte]time.Time),
+		lastMsg:           -1,
+		login:             make(chan bool, 1),
+		events:            &rcon.EventHub{},
+		done:              make(chan struct{}),
+	}
+	go client.readLoop()
+	return client
+}
+
+// Authenticate logs in with password, false means the server rejected it.
+// Keepalives start once logged in.
+func (src *Client) Authenticate(ctx context.Context, password string) (bool, error) {
+	if err := src.send(PacketLogin, []byte(password)); err != nil {
+		return false, err
+	}
+	select {
+	case ok := <-src.login:
+		if ok && src.loggedIn.CompareAndSwap(false, true) {
+			go src.keepalive()
+		}
+		return ok, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-src.done:
+		return false, src.err
+	}
+}
+
+// Execute runs cmd and returns its response, reassembled if the server split it.
+func (src *Client) Execute(ctx context.Context, cmd string) (string, error) {
+	if !src.loggedIn.Load() {
+		return "", ErrNotLoggedIn
+	}
+	seq, req, err := src.register()
+	if err != nil {
+		return "", err
+	}
+	defer src.unregister(seq)
+	if err := src.send(PacketCommand, append([]byte{seq}, cmd...)); err != nil {
+		return "", errors.Join(rcon.ErrWriteFailed, err)
+	}
+	select {
+	case body := <-req.done:
+		return string(body), nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-src.done:
+		return "", src.err
+	}
+}
+
+// ExecuteMulti is Execute, multi-part responses are always reassembled. It lets the client
+// stand in wherever an rcon.Client's ExecuteMulti is expected.
+func (src *Client) ExecuteMulti(ctx context.Context, cmd string) (string, error) {
+	return src.Execute(ctx, cmd)
+}
+
+// Subscribe returns server messages (chat, joins, kicks...) as rcon events, the packet's
+// Id is the message's sequence number. See rcon.Client.Subscribe for the options.
+func (src *Client) Subscribe(filter rcon.EventFilter, opts ...rcon.SubscribeOption) (<-chan rcon.Event, *rcon.Subscription) {
+	return src.events.Subscribe(filter, opts...)
+}
+
+// Done is closed once the connection ends, after which Err reports why.
+func (src *Client) Done() <-chan struct{} {
+	return src.done
+}
+
+func (src *Client) Err() error {
+	select {
+	case <-src.done:
+		return src.err
+	default:
+		return nil
+	}
+}
+
+func (src *Client) Close() error {
+	src.closed.Store(true)
+	return src.con.Close()
+}
+
+func (src *Client) send(packetType byte, payload []byte) error {
+	src.writeMu.Lock()
+	defer src.writeMu.Unlock()
+	_, err := src.con.Write(Encode(packetType, payload))
+	if err == nil {
+		src.lastSent.Store(time.Now().UnixNano())
+	}
+	return err
+}
+
+// register reserves the next free sequence number
+func (src *Client) register() (byte, *pendingCommand, error) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	for range 256 {
+		seq := src.seq
+		src.seq++
+		if _, busy := src.pending[seq]; busy {
+			continue
+		}
+		req := &pendingCommand{done: make(chan []byte, 1)}
+		src.pending[seq] = req
+		return seq, req, nil
+	}
+	return 0, nil, ErrTooManyPending
+}
+
+func (src *Client) unregister(seq byte) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	delete(src.pending, seq)
+}
+
+func (src *Client) readLoop() {
+	buf := make([]byte, maxDatagram)
+	for {
+		n, err := src.con.Read(buf)
+		if err != nil {
+			src.finish(err)
+			return
+		}
+		packetType, payload, err := Decode(buf[:n])
+		if err != nil {
+			logger.Debug.Printf("battleye: dropping datagram from %v: %v", src.Address, err)
+			continue
+		}
+		src.lastRecv.Store(time.Now().UnixNano())
+		src.dispatch(packetType, bytes.Clone(payload))
+	}
+}
+
+func (src *Client) dispatch(packetType byte, payload []byte) {
+	switch packetType {
+	case PacketLogin:
+		if len(payload) == 0 {
+			return
+		}
+		select {
+		case src.login <- payload[0] == 0x01:
+		default:
+		}
+	case PacketCommand:
+		if len(payload) == 0 {
+			return
+		}
+		src.deliver(payload[0], payload[1:])
+	case PacketMessage:
+		if len(payload) == 0 {
+			return
+		}
+		seq := payload[0]
+		// acknowledge every copy, the server resends until one ack arrives
+		if err := src.send(PacketMessage, []byte{seq}); err != nil {
+			logger.Warn.Printf("battleye: failed to acknowledge message %v: %v", seq, err)
+		}
+		if src.repeated(seq) {
+			return
+		}
+		src.events.Publish(rcon.Event{
+			Time:   time.Now(),
+			Packet: packet.New(int32(seq), packet.SERVERDATA_RESPONSE_VALUE, payload[1:]),
+			Kind:   rcon.EventBroadcast,
+		})
+	}
+}
+
+// deliver routes a command response, multi-part responses start with 0x00, the part count and index
+func (src *Client) deliver(seq byte, body []byte) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	req, ok := src.pending[seq]
+	if !ok {
+		logger.Debug.Printf("battleye: dropping response to unknown sequence %v", seq)
+		return
+	}
+	if len(body) < 3 || body[0] != 0x00 {
+		select {
+		case req.done <- body:
+		default:
+		}
+		return
+	}
+	count, index := int(body[1]), int(body[2])
+	if count == 0 || index >= count {
+		logger.Debug.Printf("battleye: dropping malformed part %v/%v of sequence %v", index, count, seq)
+		return
+	}
+	if req.parts == nil {
+		req.parts = make([][]byte, count)
+	}
+	if index >= len(req.parts) || req.parts[index] != nil {
+		return
+	}
+	req.parts[index] = body[3:]
+	req.received++
+	if req.received == len(req.parts) {
+		select {
+		case req.done <- bytes.Join(req.parts, nil):
+		default:
+		}
+	}
+}
+
+func (src *Client) repeated(seq byte) bool {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	now := time.Now()
+	// a sequence up to 127 ahead of the newest one is a new message even if it was seen
+	// recently, the counter wrapped around
+	ahead := src.lastMsg < 0 || seq-byte(src.lastMsg) != 0 && seq-byte(src.lastMsg) < 128
+	if seen, ok := src.messages[seq]; ok && !ahead && now.Sub(seen) < messageDedupeWindow {
+		return true
+	}
+	src.messages[seq] = now
+	if ahead {
+		src.lastMsg = int(seq)
+	}
+	return false
+}
+
+// keepalive sends an empty command whenever the client was idle for KeepaliveInterval and
+// closes the connection once the server hasn't answered for three intervals.
+func (src *Client) keepalive() {
+	interval := src.KeepaliveInterval
+	if interval <= 0 {
+		interval = DefaultKeepaliveInterval
+	}
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-src.done:
+			return
+		case now := <-ticker.C:
+			if now.Sub(time.Unix(0, src.lastRecv.Load())) > 3*interval {
+				logger.Warn.Printf("battleye: %v stopped answering, closing connection", src.Address)
+				src.finish(ErrConnectionTimedOut)
+				return
+			}
+			if now.Sub(time.Unix(0, src.lastSent.Load())) < interval {
+				continue
+			}
+			seq, _, err := src.register()
+			if err != nil {
+				continue
+			}
+			// nobody waits for the answer, it only refreshes lastRecv
+			if err := src.send(PacketCommand, []byte{seq}); err != nil {
+				logger.Warn.Printf("battleye: keepalive to %v failed: %v", src.Address, err)
+			}
+			time.AfterFunc(interval, func() { src.unregister(seq) })
+		}
+	}
+}
+
+func (src *Client) finish(err error) {
+	src.closeOnce.Do(func() {
+		if src.closed.Load() {
+			err = ErrClientClosed
+		}
+		logger.Debug.Printf("battleye: connection to %v ended: %v", src.Address, err)
+		src.err = err
+		src.con.Close()
+		close(src.done)
+		src.events.Close(err)
+	})
+}
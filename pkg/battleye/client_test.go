@@ -0,0 +1,326 @@
+package battleye
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/rcon"
+)
+
+// fakeServer answers BattlEye logins and commands on a loopback UDP socket
+type fakeServer struct {
+	con      net.PacketConn
+	password string
+	mu       sync.Mutex
+	client   net.Addr
+	acks     []byte
+	commands []string
+}
+
+func newFakeServer(t *testing.T, password string) *fakeServer {
+	t.Helper()
+	con, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &fakeServer{con: con, password: password}
+	t.Cleanup(func() { con.Close() })
+	go srv.serve()
+	return srv
+}
+
+func (src *fakeServer) serve() {
+	buf := make([]byte, maxDatagram)
+	for {
+		n, addr, err := src.con.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		packetType, payload, err := Decode(buf[:n])
+		if err != nil {
+			continue
+		}
+		src.mu.Lock()
+		src.client = addr
+		src.mu.Unlock()
+		switch packetType {
+		case PacketLogin:
+			result := byte(0)
+			if string(payload) == src.password {
+				result = 1
+			}
+			src.con.WriteTo(Encode(PacketLogin, []byte{result}), addr)
+		case PacketCommand:
+			seq, cmd := payload[0], string(payload[1:])
+			src.mu.Lock()
+			src.commands = append(src.commands, cmd)
+			src.mu.Unlock()
+			switch cmd {
+			case "players":
+				// parts may arrive out of order
+				for _, part := range [][]byte{{0, 3, 2, 'c'}, {0, 3, 0, 'a'}, {0, 3, 1, 'b'}} {
+					src.con.WriteTo(Encode(PacketCommand, append([]byte{seq}, part...)), addr)
+				}
+			case "silent":
+			default:
+				src.con.WriteTo(Encode(PacketCommand, append([]byte{seq}, "echo "+cmd...)), addr)
+			}
+		case PacketMessage:
+			src.mu.Lock()
+			src.acks = append(src.acks, payload[0])
+			src.mu.Unlock()
+		}
+	}
+}
+
+func (src *fakeServer) message(seq byte, body string) {
+	src.mu.Lock()
+	addr := src.client
+	src.mu.Unlock()
+	src.con.WriteTo(Encode(PacketMessage, append([]byte{seq}, body...)), addr)
+}
+
+func (src *fakeServer) counts() (int, int) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	keepalives := 0
+	for _, cmd := range src.commands {
+		if cmd == "" {
+			keepalives++
+		}
+	}
+	return len(src.acks), keepalives
+}
+
+func connect(t *testing.T, srv *fakeServer, password string) (*Client, bool) {
+	t.Helper()
+	client, err := New(srv.con.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ok, err := client.Authenticate(ctx, password)
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	return client, ok
+}
+
+func TestEncodeDecode(t *testing.T) {
+	data := Encode(PacketCommand, []byte{7, 'p', 'l', 'a', 'y', 'e', 'r', 's'})
+	packetType, payload, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if packetType != PacketCommand || string(payload) != "\x07players" {
+		t.Fatalf("decoded mismatch: got %v %q", packetType, payload)
+	}
+	data[len(data)-1] ^= 0xFF
+	if _, _, err := Decode(data); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+	if _, _, err := Decode([]byte("not battleye")); !errors.Is(err, ErrInvalidHeader) {
+		t.Fatalf("expected ErrInvalidHeader, got %v", err)
+	}
+}
+
+func TestClientLogin(t *testing.T) {
+	srv := newFakeServer(t, "secret")
+	if _, ok := connect(t, srv, "wrong"); ok {
+		t.Fatal("expected wrong password to be rejected")
+	}
+	client, ok := connect(t, srv, "secret")
+	if !ok {
+		t.Fatal("expected login to succeed")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	response, err := client.Execute(ctx, "version")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if response != "echo version" {
+		t.Fatalf("response mismatch: got %q want %q", response, "echo version")
+	}
+}
+
+func TestClientExecuteBeforeLogin(t *testing.T) {
+	srv := newFakeServer(t, "secret")
+	client, err := New(srv.con.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer client.Close()
+	if _, err := client.Execute(context.Background(), "players"); !errors.Is(err, ErrNotLoggedIn) {
+		t.Fatalf("expected ErrNotLoggedIn, got %v", err)
+	}
+}
+
+func TestClientMultipartResponse(t *testing.T) {
+	srv := newFakeServer(t, "secret")
+	client, _ := connect(t, srv, "secret")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	response, err := client.Execute(ctx, "players")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if response != "abc" {
+		t.Fatalf("response mismatch: got %q want %q", response, "abc")
+	}
+}
+
+func TestClientConcurrentExecute(t *testing.T) {
+	srv := newFakeServer(t, "secret")
+	client, _ := connect(t, srv, "secret")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, cmd := range []string{"a", "b", "c", "d", "e"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, err := client.Execute(ctx, cmd)
+			if err != nil {
+				t.Errorf("Execute(%q) failed: %v", cmd, err)
+				return
+			}
+			if response != "echo "+cmd {
+				t.Errorf("response mismatch: got %q want %q", response, "echo "+cmd)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestClientExecuteTimeout(t *testing.T) {
+	srv := newFakeServer(t, "secret")
+	client, _ := connect(t, srv, "secret")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.Execute(ctx, "silent"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestClientAcknowledgesMessages(t *testing.T) {
+	srv := newFakeServer(t, "secret")
+	client, _ := connect(t, srv, "secret")
+	events, _ := client.Subscribe(nil)
+
+	// the second copy is a resend of an ack the server didn't get
+	srv.message(4, "(Global) Player: hello")
+	srv.message(4, "(Global) Player: hello")
+	srv.message(5, "Player #1 Miller disconnected")
+
+	for _, want := range []string{"(Global) Player: hello", "Player #1 Miller disconnected"} {
+		select {
+		case event := <-events:
+			if event.Packet.BodyStr() != want || event.Kind != rcon.EventBroadcast {
+				t.Fatalf("event mismatch: got %q (%v) want %q", event.Packet.BodyStr(), event.Kind, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("message %q was not delivered", want)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		acks, _ := srv.counts()
+		if acks == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ack count mismatch: got %v want %v", acks, 3)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected duplicate event %q", event.Packet.BodyStr())
+	default:
+	}
+}
+
+func TestClientMessageSequenceWraps(t *testing.T) {
+	srv := newFakeServer(t, "secret")
+	client, _ := connect(t, srv, "secret")
+	events, _ := client.Subscribe(nil, rcon.WithBuffer(1024))
+
+	const count = 600
+	for i := range count {
+		srv.message(byte(i), fmt.Sprintf("message %v", i))
+		if i%64 == 63 {
+			// leave the read loop room so that loopback doesn't drop datagrams
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	for i := range count {
+		select {
+		case event := <-events:
+			if want := fmt.Sprintf("message %v", i); event.Packet.BodyStr() != want {
+				t.Fatalf("event mismatch: got %q want %q", event.Packet.BodyStr(), want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("message %v was not delivered", i)
+		}
+	}
+}
+
+func TestClientKeepalive(t *testing.T) {
+	srv := newFakeServer(t, "secret")
+	client, err := New(srv.con.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer client.Close()
+	client.KeepaliveInterval = 20 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if ok, err := client.Authenticate(ctx, "secret"); !ok || err != nil {
+		t.Fatalf("Authenticate failed: %v %v", ok, err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, keepalives := srv.counts(); keepalives >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no keepalives were sent")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if client.Err() != nil {
+		t.Fatalf("expected the connection to stay up, got %v", client.Err())
+	}
+}
+
+func TestClientTimesOutSilentServer(t *testing.T) {
+	srv := newFakeServer(t, "secret")
+	client, err := New(srv.con.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer client.Close()
+	client.KeepaliveInterval = 20 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if ok, err := client.Authenticate(ctx, "secret"); !ok || err != nil {
+		t.Fatalf("Authenticate failed: %v %v", ok, err)
+	}
+	srv.con.Close()
+	select {
+	case <-client.Done():
+	case <-ctx.Done():
+		t.Fatal("client did not notice the server went away")
+	}
+	if client.Err() == nil {
+		t.Fatal("expected an error once the server went away")
+	}
+}
@@ -0,0 +1,46 @@
+// Package battleye implements BattlEye RCon, the UDP protocol used by Arma and DayZ servers.
+package battleye
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+const (
+	PacketLogin   byte = 0x00
+	PacketCommand byte = 0x01
+	PacketMessage byte = 0x02
+
+	headerSize = 7
+)
+
+var (
+	ErrInvalidHeader    error = errors.New("not a battleye packet")
+	ErrChecksumMismatch error = errors.New("battleye packet checksum mismatch")
+)
+
+// Encode wraps payload as a BattlEye packet: "BE", the CRC32 of what follows,
+// 0xFF, the packet type and the payload.
+func Encode(packetType byte, payload []byte) []byte {
+	out := make([]byte, headerSize+1+len(payload))
+	out[0], out[1] = 'B', 'E'
+	out[6] = 0xFF
+	out[7] = packetType
+	copy(out[8:], payload)
+	binary.LittleEndian.PutUint32(out[2:6], crc32.ChecksumIEEE(out[6:]))
+	return out
+}
+
+// Decode validates a BattlEye packet and returns its type and payload.
+func Decode(data []byte) (byte, []byte, error) {
+	if len(data) < headerSize+1 || data[0] != 'B' || data[1] != 'E' || data[6] != 0xFF {
+		return 0, nil, ErrInvalidHeader
+	}
+	want := binary.LittleEndian.Uint32(data[2:6])
+	if got := crc32.ChecksumIEEE(data[6:]); got != want {
+		return 0, nil, fmt.Errorf("%w: got %08x want %08x", ErrChecksumMismatch, got, want)
+	}
+	return data[7], data[8:], nil
+}
@@ -8,13 +8,15 @@ import (
 	"github.com/UltimateForm/tcprcon/pkg/packet"
 )
 
-type rconClient interface {
+// Conn is a raw RCON connection that hands out packet IDs, such as an *rcon.Client
+// before its reader starts, or a fake in tests.
+type Conn interface {
 	io.Reader
 	io.Writer
 	Id() int32
 }
 
-func Authenticate(rconClient rconClient, password string) (bool, error) {
+func Authenticate(rconClient Conn, password string) (bool, error) {
 	authId := rconClient.Id()
 	authPacket := packet.NewAuthPacket(authId, password)
 	written, err := rconClient.Write(authPacket.Serialize())
@@ -22,18 +24,25 @@ func Authenticate(rconClient rconClient, password string) (bool, error) {
 		return false, err
 	}
 	logger.Debug.Printf("Written %v bytes of auth packet to connection", written)
-	responsePkt, err := packet.ReadWithId(rconClient, authId)
+	responsePkt, err := packet.Read(rconClient)
 	if err != nil {
 		return false, err
 	}
 
 	if responsePkt.Type == packet.SERVERDATA_RESPONSE_VALUE {
 		logger.Debug.Printf("We got that flaky mythical empty server response, let's read again")
-		responsePkt, err = packet.ReadWithId(rconClient, authId)
+		responsePkt, err = packet.Read(rconClient)
 		if err != nil {
 			return false, err
 		}
 	}
+	// servers reply with ID -1 when the password is wrong
+	if responsePkt.Id == -1 {
+		return false, nil
+	}
+	if responsePkt.Id != authId {
+		return false, packet.ErrPacketIdMismatch
+	}
 	if responsePkt.Type != packet.SERVERDATA_AUTH_RESPONSE {
 		return false, fmt.Errorf(
 			"unexpected packet type %v, expected %v",
@@ -0,0 +1,173 @@
+// Package faultconn wraps a net.Conn to misbehave the way real networks and game servers do.
+// Every decision comes from a seeded RNG so a failing run can be replayed.
+package faultconn
+
+import (
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+)
+
+var ErrInjectedClose error = errors.New("connection closed by fault injection")
+
+type Config struct {
+	Seed uint64
+	// MaxWriteFragment splits every Write into chunks of 1 to MaxWriteFragment bytes,
+	// each sent separately, zero disables
+	MaxWriteFragment int
+	// MaxReadFragment caps every Read to 1 to MaxReadFragment bytes, zero disables
+	MaxReadFragment int
+	// Latency is waited before every write chunk, give or take up to Jitter
+	Latency time.Duration
+	Jitter  time.Duration
+	// CorruptRate is the probability of each byte being flipped, in either direction
+	CorruptRate float64
+	// CloseAfter closes the connection once that many bytes were read and written in total,
+	// zero disables
+	CloseAfter int64
+}
+
+type Conn struct {
+	net.Conn
+	config Config
+	// reads and writes draw from separate generators so that their interleaving
+	// doesn't change the faults injected in either direction
+	reads       *source
+	writes      *source
+	countMu     sync.Mutex
+	transferred int64
+}
+
+type source struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func (src *source) intn(n int) int {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	return src.rng.IntN(n)
+}
+
+func (src *source) int64n(n int64) int64 {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	return src.rng.Int64N(n)
+}
+
+func (src *source) corrupt(p []byte, rate float64) {
+	if rate <= 0 {
+		return
+	}
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	for i := range p {
+		if src.rng.Float64() < rate {
+			p[i] ^= byte(src.rng.IntN(255) + 1)
+		}
+	}
+}
+
+func Wrap(con net.Conn, config Config) *Conn {
+	return &Conn{
+		Conn:   con,
+		config: config,
+		reads:  &source{rng: rand.New(rand.NewPCG(config.Seed, 1))},
+		writes: &source{rng: rand.New(rand.NewPCG(config.Seed, 2))},
+	}
+}
+
+// WrapFunc adapts Wrap for hooks taking a func(net.Conn) net.Conn, like rcontest.Server.WrapConn.
+func WrapFunc(config Config) func(net.Conn) net.Conn {
+	return func(con net.Conn) net.Conn {
+		return Wrap(con, config)
+	}
+}
+
+func (src *Conn) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return src.Conn.Read(p)
+	}
+	if src.config.MaxReadFragment > 0 {
+		p = p[:min(len(p), src.reads.intn(src.config.MaxReadFragment)+1)]
+	}
+	allowed, closeNow := src.reserve(len(p))
+	if allowed == 0 && closeNow {
+		src.Conn.Close()
+		return 0, io.EOF
+	}
+	n, err := src.Conn.Read(p[:allowed])
+	src.reads.corrupt(p[:n], src.config.CorruptRate)
+	src.commit(n)
+	if closeNow && n == allowed {
+		src.Conn.Close()
+	}
+	return n, err
+}
+
+func (src *Conn) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		chunk := len(p) - written
+		if src.config.MaxWriteFragment > 0 {
+			chunk = min(chunk, src.writes.intn(src.config.MaxWriteFragment)+1)
+		}
+		src.delay()
+		allowed, closeNow := src.reserve(chunk)
+		buf := make([]byte, allowed)
+		copy(buf, p[written:written+allowed])
+		src.writes.corrupt(buf, src.config.CorruptRate)
+		n, err := src.Conn.Write(buf)
+		written += n
+		src.commit(n)
+		if err != nil {
+			return written, err
+		}
+		if closeNow {
+			src.Conn.Close()
+			return written, ErrInjectedClose
+		}
+	}
+	return written, nil
+}
+
+// Transferred returns how many bytes went through the connection in both directions.
+func (src *Conn) Transferred() int64 {
+	src.countMu.Lock()
+	defer src.countMu.Unlock()
+	return src.transferred
+}
+
+// reserve trims n to what CloseAfter still allows and reports whether the
+// connection must be closed once those bytes went through.
+func (src *Conn) reserve(n int) (int, bool) {
+	if src.config.CloseAfter <= 0 {
+		return n, false
+	}
+	src.countMu.Lock()
+	defer src.countMu.Unlock()
+	remaining := src.config.CloseAfter - src.transferred
+	if remaining <= int64(n) {
+		return int(max(remaining, 0)), true
+	}
+	return n, false
+}
+
+func (src *Conn) commit(n int) {
+	src.countMu.Lock()
+	defer src.countMu.Unlock()
+	src.transferred += int64(n)
+}
+
+func (src *Conn) delay() {
+	wait := src.config.Latency
+	if src.config.Jitter > 0 {
+		wait += time.Duration(src.writes.int64n(int64(2*src.config.Jitter)+1)) - src.config.Jitter
+	}
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
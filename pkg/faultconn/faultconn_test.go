@@ -0,0 +1,108 @@
+package faultconn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/rcon"
+	"github.com/UltimateForm/tcprcon/pkg/rcontest"
+)
+
+func dialFaulty(t *testing.T, server *rcontest.Server, config Config) *rcon.Client {
+	t.Helper()
+	con, err := net.Dial("tcp", server.Addr)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	client := rcon.NewFromConn(server.Addr, Wrap(con, config))
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestFragmentedExchange(t *testing.T) {
+	for seed := uint64(1); seed <= 5; seed++ {
+		t.Run(fmt.Sprintf("seed %d", seed), func(t *testing.T) {
+			config := Config{
+				Seed:             seed,
+				MaxWriteFragment: 3,
+				MaxReadFragment:  2,
+				Latency:          100 * time.Microsecond,
+				Jitter:           100 * time.Microsecond,
+			}
+			server := rcontest.NewUnstartedServer("secret")
+			server.WrapConn = WrapFunc(config)
+			server.Start()
+			defer server.Close()
+			server.Respond("cvarlist", "sv_cheats 0\n", "sv_gravity 800\n")
+			client := dialFaulty(t, server, config)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			ok, err := client.Authenticate(ctx, "secret")
+			if err != nil || !ok {
+				t.Fatalf("Authenticate failed: %v %v", ok, err)
+			}
+			response, err := client.ExecuteMulti(ctx, "cvarlist")
+			if err != nil {
+				t.Fatalf("ExecuteMulti failed: %v", err)
+			}
+			if response != "sv_cheats 0\nsv_gravity 800\n" {
+				t.Fatalf("response mismatch: got %q", response)
+			}
+		})
+	}
+}
+
+func TestCloseAfter(t *testing.T) {
+	server := rcontest.NewServer("secret")
+	defer server.Close()
+	server.Respond("playerlist", strings.Repeat("player\n", 50))
+	client := dialFaulty(t, server, Config{CloseAfter: 100})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ok, err := client.Authenticate(ctx, "secret")
+	if err != nil || !ok {
+		t.Fatalf("Authenticate failed: %v %v", ok, err)
+	}
+	_, err = client.Execute(ctx, "playerlist")
+	if err == nil {
+		t.Fatal("expected the connection to drop mid-response")
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("connection drop should surface before the deadline, got %v", err)
+	}
+}
+
+func TestCorruptionIsReproducible(t *testing.T) {
+	config := Config{Seed: 42, CorruptRate: 0.2}
+	run := func() []byte {
+		clientSide, serverSide := net.Pipe()
+		defer clientSide.Close()
+		defer serverSide.Close()
+		faulty := Wrap(clientSide, config)
+		go faulty.Write([]byte("the quick brown fox jumps over the lazy dog"))
+		buf := make([]byte, 43)
+		n := 0
+		for n < len(buf) {
+			read, err := serverSide.Read(buf[n:])
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			n += read
+		}
+		return buf
+	}
+	first, second := run(), run()
+	if string(first) != string(second) {
+		t.Fatalf("same seed produced different corruption: %q vs %q", first, second)
+	}
+	if string(first) == "the quick brown fox jumps over the lazy dog" {
+		t.Fatal("expected some bytes to be corrupted")
+	}
+}
@@ -0,0 +1,136 @@
+package mordhau
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/UltimateForm/tcprcon/pkg/logger"
+	"github.com/UltimateForm/tcprcon/pkg/rcon"
+)
+
+const noPlayers = "There are currently no players present"
+
+type subscriber interface {
+	rcon.Executor
+	rcon.Subscriber
+}
+
+// persistentSubscriber is implemented by rcon.ReconnectingClient
+type persistentSubscriber interface {
+	AddSubscription(ctx context.Context, cmd string) error
+}
+
+// Listen opts into the given broadcast channels, every channel when none are given.
+// With an rcon.ReconnectingClient the listen commands are replayed after reconnects.
+func Listen(ctx context.Context, client rcon.Executor, channels ...Channel) error {
+	if len(channels) == 0 {
+		channels = Channels
+	}
+	for _, channel := range channels {
+		cmd := "listen " + string(channel)
+		var err error
+		if persistent, ok := client.(persistentSubscriber); ok {
+			err = persistent.AddSubscription(ctx, cmd)
+		} else {
+			_, err = client.ExecuteMulti(ctx, cmd)
+		}
+		if err != nil {
+			return fmt.Errorf("%v failed: %w", cmd, err)
+		}
+	}
+	return nil
+}
+
+// Subscribe listens to channels and returns their broadcasts as typed events, opts apply to the
+// underlying rcon subscription. The channel is closed after the subscription ends, which it
+// also does once ctx is done. Broadcasts that fail to parse are logged and skipped.
+func Subscribe(ctx context.Context, client subscriber, channels []Channel, opts ...rcon.SubscribeOption) (<-chan Event, *rcon.Subscription, error) {
+	if len(channels) == 0 {
+		channels = Channels
+	}
+	// subscribe first so that nothing sent right after the listen commands is missed
+	raw, subscription := client.Subscribe(rcon.KindFilter(rcon.EventBroadcast), opts...)
+	// ending the subscription closes raw, even while no broadcast arrives
+	stop := context.AfterFunc(ctx, subscription.Cancel)
+	if err := Listen(ctx, client, channels...); err != nil {
+		stop()
+		subscription.Cancel()
+		return nil, nil, err
+	}
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		defer stop()
+		for event := range raw {
+			parsed, err := Parse(event.Packet.BodyStr())
+			if err != nil {
+				logger.Debug.Printf("mordhau: skipping broadcast: %v", err)
+				continue
+			}
+			if !slices.Contains(channels, parsed.Channel()) {
+				continue
+			}
+			select {
+			case events <- parsed:
+			case <-subscription.Done():
+				return
+			}
+		}
+	}()
+	return events, subscription, nil
+}
+
+type Player struct {
+	PlayFabID string
+	Name      string
+	// Ping in milliseconds
+	Ping int
+	Team int
+}
+
+// PlayerList runs "playerlist" and parses its output.
+func PlayerList(ctx context.Context, client rcon.Executor) ([]Player, error) {
+	response, err := client.ExecuteMulti(ctx, "playerlist")
+	if err != nil {
+		return nil, err
+	}
+	return ParsePlayerList(response)
+}
+
+// ParsePlayerList parses playerlist output made of lines like "2B3C5D7E9F1A2B3C, Name, 63 ms, team 1".
+// Names may contain commas, so the ID is taken from the start of the line and ping and team from its end.
+func ParsePlayerList(body string) ([]Player, error) {
+	players := []Player{}
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, noPlayers) {
+			continue
+		}
+		id, rest, found := strings.Cut(line, ", ")
+		if !found {
+			return nil, fmt.Errorf("malformed playerlist line %q", line)
+		}
+		fields := strings.Split(rest, ", ")
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("malformed playerlist line %q", line)
+		}
+		ping, err := strconv.Atoi(strings.TrimSuffix(fields[len(fields)-2], " ms"))
+		if err != nil {
+			return nil, fmt.Errorf("malformed ping in playerlist line %q", line)
+		}
+		team, err := strconv.Atoi(strings.TrimPrefix(fields[len(fields)-1], "team "))
+		if err != nil {
+			return nil, fmt.Errorf("malformed team in playerlist line %q", line)
+		}
+		players = append(players, Player{
+			PlayFabID: id,
+			Name:      strings.Join(fields[:len(fields)-2], ", "),
+			Ping:      ping,
+			Team:      team,
+		})
+	}
+	return players, nil
+}
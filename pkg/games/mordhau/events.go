@@ -0,0 +1,156 @@
+// Package mordhau parses the broadcasts and command output of Mordhau servers.
+package mordhau
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeLayout is how Mordhau formats timestamps inside broadcasts, e.g. 2024.05.17-21.04.33.
+const TimeLayout = "2006.01.02-15.04.05"
+
+var (
+	ErrUnknownEvent   error = errors.New("not a mordhau broadcast")
+	ErrMalformedEvent error = errors.New("malformed mordhau broadcast")
+)
+
+// Channel is a broadcast channel opted into with "listen <channel>".
+type Channel string
+
+const (
+	ChannelKillfeed   Channel = "killfeed"
+	ChannelChat       Channel = "chat"
+	ChannelLogin      Channel = "login"
+	ChannelMatchState Channel = "matchstate"
+	ChannelScorefeed  Channel = "scorefeed"
+)
+
+var Channels = []Channel{ChannelKillfeed, ChannelChat, ChannelLogin, ChannelMatchState, ChannelScorefeed}
+
+// Event is one of KillfeedEvent, ChatEvent, LoginEvent, MatchStateEvent or ScorefeedEvent.
+type Event interface {
+	Channel() Channel
+}
+
+// KillfeedEvent reports a kill, KillerPlayFabID is empty for environmental deaths.
+type KillfeedEvent struct {
+	Time            time.Time
+	Killer          string
+	KillerPlayFabID string
+	Victim          string
+	VictimPlayFabID string
+}
+
+type ChatEvent struct {
+	PlayFabID string
+	Name      string
+	// Scope is the chat the message went to, e.g. "ALL" or "TEAM"
+	Scope   string
+	Message string
+}
+
+type LoginEvent struct {
+	Time      time.Time
+	Name      string
+	PlayFabID string
+	// LoggedIn is false when the player logged out
+	LoggedIn bool
+}
+
+type MatchStateEvent struct {
+	// State is e.g. "Waiting to start", "In progress" or "Leaving map"
+	State string
+}
+
+type ScorefeedEvent struct {
+	Time      time.Time
+	Name      string
+	PlayFabID string
+	Change    float64
+	Score     float64
+}
+
+func (KillfeedEvent) Channel() Channel   { return ChannelKillfeed }
+func (ChatEvent) Channel() Channel       { return ChannelChat }
+func (LoginEvent) Channel() Channel      { return ChannelLogin }
+func (MatchStateEvent) Channel() Channel { return ChannelMatchState }
+func (ScorefeedEvent) Channel() Channel  { return ChannelScorefeed }
+
+var (
+	killfeedPattern  = regexp.MustCompile(`^(\S+): (\w*) \((.*?)\) killed (\w*) \((.*)\)$`)
+	chatPattern      = regexp.MustCompile(`^(\w+), (.*), \((\w+)\) (.*)$`)
+	loginPattern     = regexp.MustCompile(`^(\S+): (.*) \((\w+)\) logged (in|out)$`)
+	scorefeedPattern = regexp.MustCompile(`^(\S+): (\w+) \((.*)\)'s score changed by (-?[\d.]+) points and is now (-?[\d.]+) points$`)
+)
+
+// Parse turns the body of a broadcast into a typed event. Bodies of other broadcasts
+// return ErrUnknownEvent, recognized ones that don't match their format ErrMalformedEvent.
+func Parse(body string) (Event, error) {
+	prefix, rest, found := strings.Cut(strings.TrimSpace(body), ": ")
+	if !found {
+		return nil, ErrUnknownEvent
+	}
+	switch Channel(strings.ToLower(prefix)) {
+	case ChannelKillfeed:
+		match := killfeedPattern.FindStringSubmatch(rest)
+		if match == nil {
+			return nil, malformed(body)
+		}
+		timestamp, err := time.Parse(TimeLayout, match[1])
+		if err != nil {
+			return nil, malformed(body)
+		}
+		return KillfeedEvent{
+			Time:            timestamp,
+			KillerPlayFabID: match[2],
+			Killer:          match[3],
+			VictimPlayFabID: match[4],
+			Victim:          match[5],
+		}, nil
+	case ChannelChat:
+		match := chatPattern.FindStringSubmatch(rest)
+		if match == nil {
+			return nil, malformed(body)
+		}
+		return ChatEvent{PlayFabID: match[1], Name: match[2], Scope: match[3], Message: match[4]}, nil
+	case ChannelLogin:
+		match := loginPattern.FindStringSubmatch(rest)
+		if match == nil {
+			return nil, malformed(body)
+		}
+		timestamp, err := time.Parse(TimeLayout, match[1])
+		if err != nil {
+			return nil, malformed(body)
+		}
+		return LoginEvent{Time: timestamp, Name: match[2], PlayFabID: match[3], LoggedIn: match[4] == "in"}, nil
+	case ChannelMatchState:
+		return MatchStateEvent{State: rest}, nil
+	case ChannelScorefeed:
+		match := scorefeedPattern.FindStringSubmatch(rest)
+		if match == nil {
+			return nil, malformed(body)
+		}
+		timestamp, err := time.Parse(TimeLayout, match[1])
+		if err != nil {
+			return nil, malformed(body)
+		}
+		change, err := strconv.ParseFloat(match[4], 64)
+		if err != nil {
+			return nil, malformed(body)
+		}
+		score, err := strconv.ParseFloat(match[5], 64)
+		if err != nil {
+			return nil, malformed(body)
+		}
+		return ScorefeedEvent{Time: timestamp, PlayFabID: match[2], Name: match[3], Change: change, Score: score}, nil
+	}
+	return nil, ErrUnknownEvent
+}
+
+func malformed(body string) error {
+	return fmt.Errorf("%w: %q", ErrMalformedEvent, body)
+}
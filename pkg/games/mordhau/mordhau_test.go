@@ -0,0 +1,229 @@
+package mordhau
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/rcon"
+	"github.com/UltimateForm/tcprcon/pkg/rcontest"
+)
+
+func TestParse(t *testing.T) {
+	at := time.Date(2024, 5, 17, 21, 4, 33, 0, time.UTC)
+	cases := []struct {
+		body string
+		want Event
+	}{
+		{
+			"Killfeed: 2024.05.17-21.04.33: 1A2B3C4D5E6F7081 (Sir Stab (EU)) killed 8091A2B3C4D5E6F7 (Peasant)",
+			KillfeedEvent{Time: at, KillerPlayFabID: "1A2B3C4D5E6F7081", Killer: "Sir Stab (EU)", VictimPlayFabID: "8091A2B3C4D5E6F7", Victim: "Peasant"},
+		},
+		{
+			"Killfeed: 2024.05.17-21.04.33:  () killed 8091A2B3C4D5E6F7 (Peasant)",
+			KillfeedEvent{Time: at, VictimPlayFabID: "8091A2B3C4D5E6F7", Victim: "Peasant"},
+		},
+		{
+			"Chat: 1A2B3C4D5E6F7081, Sir, Stab, (ALL) gg, well played",
+			ChatEvent{PlayFabID: "1A2B3C4D5E6F7081", Name: "Sir, Stab", Scope: "ALL", Message: "gg, well played"},
+		},
+		{
+			"Login: 2024.05.17-21.04.33: Peasant (8091A2B3C4D5E6F7) logged in",
+			LoginEvent{Time: at, Name: "Peasant", PlayFabID: "8091A2B3C4D5E6F7", LoggedIn: true},
+		},
+		{
+			"Login: 2024.05.17-21.04.33: Peasant (8091A2B3C4D5E6F7) logged out\n",
+			LoginEvent{Time: at, Name: "Peasant", PlayFabID: "8091A2B3C4D5E6F7"},
+		},
+		{
+			"MatchState: In progress",
+			MatchStateEvent{State: "In progress"},
+		},
+		{
+			"Scorefeed: 2024.05.17-21.04.33: 1A2B3C4D5E6F7081 (Sir Stab)'s score changed by -5.0 points and is now 120.5 points",
+			ScorefeedEvent{Time: at, PlayFabID: "1A2B3C4D5E6F7081", Name: "Sir Stab", Change: -5, Score: 120.5},
+		},
+	}
+	for _, tc := range cases {
+		got, err := Parse(tc.body)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tc.body, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("Parse(%q) mismatch: got %+v want %+v", tc.body, got, tc.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	if _, err := Parse("Keeping client alive"); !errors.Is(err, ErrUnknownEvent) {
+		t.Fatalf("expected ErrUnknownEvent, got %v", err)
+	}
+	if _, err := Parse("Killfeed: yesterday: someone killed someone"); !errors.Is(err, ErrMalformedEvent) {
+		t.Fatalf("expected ErrMalformedEvent, got %v", err)
+	}
+}
+
+func TestParsePlayerList(t *testing.T) {
+	body := "1A2B3C4D5E6F7081, Sir, Stab, 63 ms, team 1\n8091A2B3C4D5E6F7, Peasant, 120 ms, team 0\n"
+	players, err := ParsePlayerList(body)
+	if err != nil {
+		t.Fatalf("ParsePlayerList failed: %v", err)
+	}
+	want := []Player{
+		{PlayFabID: "1A2B3C4D5E6F7081", Name: "Sir, Stab", Ping: 63, Team: 1},
+		{PlayFabID: "8091A2B3C4D5E6F7", Name: "Peasant", Ping: 120, Team: 0},
+	}
+	if !reflect.DeepEqual(players, want) {
+		t.Fatalf("players mismatch: got %+v want %+v", players, want)
+	}
+
+	players, err = ParsePlayerList("There are currently no players present")
+	if err != nil || len(players) != 0 {
+		t.Fatalf("expected no players, got %+v %v", players, err)
+	}
+	if _, err := ParsePlayerList("garbage"); err == nil {
+		t.Fatal("expected malformed line to fail")
+	}
+}
+
+// fakeExecutor answers commands from a map, standing in for any rcon.Executor
+type fakeExecutor map[string]string
+
+func (src fakeExecutor) Execute(ctx context.Context, cmd string) (string, error) {
+	response, ok := src[cmd]
+	if !ok {
+		return "", errors.New("unknown command " + cmd)
+	}
+	return response, nil
+}
+
+func (src fakeExecutor) ExecuteMulti(ctx context.Context, cmd string) (string, error) {
+	return src.Execute(ctx, cmd)
+}
+
+func TestPlayerListWithFakeExecutor(t *testing.T) {
+	client := fakeExecutor{"playerlist": "1A2B3C4D5E6F7081, Peasant, 63 ms, team 1"}
+	players, err := PlayerList(context.Background(), client)
+	if err != nil {
+		t.Fatalf("PlayerList failed: %v", err)
+	}
+	if len(players) != 1 || players[0].Name != "Peasant" {
+		t.Fatalf("players mismatch: got %+v", players)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	srv := rcontest.NewServer("secret")
+	defer srv.Close()
+	srv.HandleDefault(func(cmd string) []string { return []string{""} })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := rcon.New(srv.Addr)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer client.Close()
+	if ok, err := client.Authenticate(ctx, "secret"); !ok || err != nil {
+		t.Fatalf("Authenticate failed: %v %v", ok, err)
+	}
+
+	events, subscription, err := Subscribe(ctx, client, []Channel{ChannelChat, ChannelMatchState})
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	srv.AssertReceived(t, "listen chat")
+	srv.AssertReceived(t, "listen matchstate")
+	srv.AssertNotReceived(t, "listen killfeed")
+
+	srv.Broadcast("Keeping client alive")
+	srv.Broadcast("Login: 2024.05.17-21.04.33: Peasant (8091A2B3C4D5E6F7) logged in")
+	srv.Broadcast("MatchState: Leaving map")
+	select {
+	case event := <-events:
+		if event != (MatchStateEvent{State: "Leaving map"}) {
+			t.Fatalf("event mismatch: got %+v", event)
+		}
+	case <-ctx.Done():
+		t.Fatal("event was not delivered")
+	}
+	subscription.Cancel()
+	if _, ok := <-events; ok {
+		t.Fatal("expected events to be closed after Cancel")
+	}
+}
+
+func TestSubscribeEndsWithPendingEvent(t *testing.T) {
+	srv := rcontest.NewServer("secret")
+	defer srv.Close()
+	srv.HandleDefault(func(cmd string) []string { return []string{""} })
+	client, err := rcon.New(srv.Addr)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer client.Close()
+	if ok, err := client.Authenticate(context.Background(), "secret"); !ok || err != nil {
+		t.Fatalf("Authenticate failed: %v %v", ok, err)
+	}
+
+	for _, end := range []string{"context", "cancel"} {
+		ctx, cancel := context.WithCancel(context.Background())
+		events, subscription, err := Subscribe(ctx, client, []Channel{ChannelMatchState})
+		if err != nil {
+			t.Fatalf("Subscribe failed: %v", err)
+		}
+		// nobody reads, so the parsed event stays pending
+		srv.Broadcast("MatchState: Leaving map")
+		srv.Broadcast("MatchState: Waiting to start")
+		time.Sleep(100 * time.Millisecond)
+		if end == "context" {
+			cancel()
+		} else {
+			subscription.Cancel()
+		}
+		timeout := time.After(5 * time.Second)
+	drain:
+		for {
+			select {
+			case _, ok := <-events:
+				if !ok {
+					break drain
+				}
+			case <-timeout:
+				t.Fatalf("events were not closed after the %v ended", end)
+			}
+		}
+		cancel()
+	}
+}
+
+func TestSubscribeEndsWithoutBroadcasts(t *testing.T) {
+	srv := rcontest.NewServer("secret")
+	defer srv.Close()
+	srv.HandleDefault(func(cmd string) []string { return []string{""} })
+	client, err := rcon.New(srv.Addr)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer client.Close()
+	if ok, err := client.Authenticate(context.Background(), "secret"); !ok || err != nil {
+		t.Fatalf("Authenticate failed: %v %v", ok, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, _, err := Subscribe(ctx, client, []Channel{ChannelMatchState})
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	cancel()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatal("expected no event")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("events were not closed after the context ended")
+	}
+}
@@ -0,0 +1,381 @@
+// Package gateway exposes RCON servers over HTTP/JSON and Server-Sent Events.
+package gateway
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/logger"
+	"github.com/UltimateForm/tcprcon/pkg/packet"
+	"github.com/UltimateForm/tcprcon/pkg/rcon"
+)
+
+const defaultTimeout = 30 * time.Second
+
+type ServerConfig struct {
+	Address  string `json:"address"`
+	Password string `json:"password"`
+	// Dialect is one of rcon.DialectNames, defaults to source
+	Dialect string `json:"dialect"`
+	// Tokens grant access to this server only, on top of Config.Tokens
+	Tokens []string `json:"tokens"`
+}
+
+type Config struct {
+	// Tokens grant access to every server, sent as "Authorization: Bearer <token>"
+	Tokens  []string                `json:"tokens"`
+	Servers map[string]ServerConfig `json:"servers"`
+	// TimeoutMs bounds each command, defaults to 30 seconds
+	TimeoutMs int `json:"timeoutMs"`
+}
+
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	file, err := os.Open(path)
+	if err != nil {
+		return config, err
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return config, fmt.Errorf("invalid gateway config %v: %w", path, err)
+	}
+	return config, nil
+}
+
+type ExecRequest struct {
+	Command string `json:"command"`
+}
+
+type ExecResponse struct {
+	Id         int32  `json:"id"`
+	Body       string `json:"body"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+type Event struct {
+	Id   int32  `json:"id"`
+	Type int32  `json:"type"`
+	Body string `json:"body"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Gateway is an http.Handler serving
+//
+//	GET  /servers               names of the configured servers
+//	POST /servers/{name}/exec   runs {"command": "..."} and returns {id, body, durationMs}
+//	GET  /servers/{name}/events streams packets as Server-Sent Events, ?listen=a,b sends
+//	                            "listen a" and "listen b" first to opt into broadcasts
+type Gateway struct {
+	config   Config
+	dialects map[string]rcon.Dialect
+	mux      *http.ServeMux
+	// dialing serializes connecting to one server without holding up the others
+	dialing map[string]*sync.Mutex
+	mu      sync.Mutex
+	clients map[string]*rcon.Client
+	closed  bool
+}
+
+func New(config Config) (*Gateway, error) {
+	if len(config.Servers) == 0 {
+		return nil, errors.New("gateway config has no servers")
+	}
+	gateway := &Gateway{
+		config:   config,
+		dialects: make(map[string]rcon.Dialect),
+		mux:      http.NewServeMux(),
+		dialing:  make(map[string]*sync.Mutex),
+		clients:  make(map[string]*rcon.Client),
+	}
+	for name, server := range config.Servers {
+		dialectName := server.Dialect
+		if dialectName == "" {
+			dialectName = rcon.SourceDialect.Name
+		}
+		dialect, err := rcon.LookupDialect(dialectName)
+		if err != nil {
+			return nil, fmt.Errorf("server %v: %w", name, err)
+		}
+		gateway.dialects[name] = dialect
+		gateway.dialing[name] = &sync.Mutex{}
+	}
+	gateway.mux.HandleFunc("GET /servers", gateway.listServers)
+	gateway.mux.HandleFunc("POST /servers/{name}/exec", gateway.authorized(gateway.exec))
+	gateway.mux.HandleFunc("GET /servers/{name}/events", gateway.authorized(gateway.events))
+	return gateway, nil
+}
+
+func (src *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	src.mux.ServeHTTP(w, r)
+}
+
+// Close drops the shared command connections, event streams end with their requests.
+func (src *Gateway) Close() error {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	src.closed = true
+	var err error
+	for name, client := range src.clients {
+		err = errors.Join(err, client.Close())
+		delete(src.clients, name)
+	}
+	return err
+}
+
+func (src *Gateway) timeout() time.Duration {
+	if src.config.TimeoutMs <= 0 {
+		return defaultTimeout
+	}
+	return time.Duration(src.config.TimeoutMs) * time.Millisecond
+}
+
+func (src *Gateway) listServers(w http.ResponseWriter, r *http.Request) {
+	if !src.hasToken(r, src.config.Tokens) {
+		unauthorized(w)
+		return
+	}
+	names := make([]string, 0, len(src.config.Servers))
+	for name := range src.config.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	writeJSON(w, http.StatusOK, names)
+}
+
+// authorized resolves {name} and checks the bearer token against the global and per-server tokens
+func (src *Gateway) authorized(next func(http.ResponseWriter, *http.Request, string, ServerConfig)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		server, ok := src.config.Servers[name]
+		if !ok {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: fmt.Sprintf("unknown server %q", name)})
+			return
+		}
+		if !src.hasToken(r, src.config.Tokens) && !src.hasToken(r, server.Tokens) {
+			unauthorized(w)
+			return
+		}
+		next(w, r, name, server)
+	}
+}
+
+func (src *Gateway) hasToken(r *http.Request, tokens []string) bool {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || token == "" {
+		return false
+	}
+	for _, accepted := range tokens {
+		if subtle.ConstantTimeCompare([]byte(accepted), []byte(token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (src *Gateway) exec(w http.ResponseWriter, r *http.Request, name string, server ServerConfig) {
+	var request ExecRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || strings.TrimSpace(request.Command) == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: `expected a JSON body like {"command": "status"}`})
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), src.timeout())
+	defer cancel()
+	client, err := src.client(ctx, name, server)
+	if err != nil {
+		logger.Err.Printf("gateway: connecting to %v failed: %v", name, err)
+		writeJSON(w, http.StatusBadGateway, errorResponse{Error: err.Error()})
+		return
+	}
+	started := time.Now()
+	pkt, err := client.ExecuteMultiPacket(ctx, request.Command)
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeJSON(w, http.StatusGatewayTimeout, errorResponse{Error: "timeout waiting for response"})
+		return
+	}
+	if err != nil {
+		logger.Err.Printf("gateway: executing %q on %v failed: %v", request.Command, name, err)
+		writeJSON(w, http.StatusBadGateway, errorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, ExecResponse{
+		Id:         pkt.Id,
+		Body:       pkt.BodyStr(),
+		DurationMs: time.Since(started).Milliseconds(),
+	})
+}
+
+// client returns the shared command connection of a server, redialing it if it died
+func (src *Gateway) client(ctx context.Context, name string, server ServerConfig) (*rcon.Client, error) {
+	dialing := src.dialing[name]
+	dialing.Lock()
+	defer dialing.Unlock()
+	if client := src.current(name); client != nil {
+		return client, nil
+	}
+	client, err := src.dial(ctx, name, server)
+	if err != nil {
+		return nil, err
+	}
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	if src.closed {
+		client.Close()
+		return nil, errors.New("gateway closed")
+	}
+	src.clients[name] = client
+	return client, nil
+}
+
+// current returns the server's connection if it's still alive
+func (src *Gateway) current(name string) *rcon.Client {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	client, ok := src.clients[name]
+	if !ok {
+		return nil
+	}
+	if client.Err() == nil {
+		return client
+	}
+	logger.Warn.Printf("gateway: connection to %v lost: %v", name, client.Err())
+	delete(src.clients, name)
+	return nil
+}
+
+func (src *Gateway) dial(ctx context.Context, name string, server ServerConfig) (*rcon.Client, error) {
+	client, err := rcon.DialContext(ctx, nil, server.Address, rcon.WithDialect(src.dialects[name]))
+	if err != nil {
+		return nil, err
+	}
+	ok, err := client.Authenticate(ctx, server.Password)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	if !ok {
+		client.Close()
+		return nil, fmt.Errorf("authentication to %v failed", name)
+	}
+	return client, nil
+}
+
+func (src *Gateway) events(w http.ResponseWriter, r *http.Request, name string, server ServerConfig) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	dialCtx, cancelDial := context.WithTimeout(ctx, src.timeout())
+	client, err := src.dial(dialCtx, name, server)
+	cancelDial()
+	if err != nil {
+		logger.Err.Printf("gateway: event stream to %v failed: %v", name, err)
+		writeJSON(w, http.StatusBadGateway, errorResponse{Error: err.Error()})
+		return
+	}
+	defer client.Close()
+
+	// each stream owns its connection, so it can be read directly instead of through the dispatcher
+	var writeMu sync.Mutex
+	ignored := make(map[int32]bool)
+	write := func(cmd string, ignore bool) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		id := client.Id()
+		if ignore {
+			ignored[id] = true
+		}
+		_, err := client.Write(packet.New(id, packet.SERVERDATA_EXECCOMMAND, []byte(cmd)).Serialize())
+		return err
+	}
+	for _, channel := range strings.Split(r.URL.Query().Get("listen"), ",") {
+		if channel = strings.TrimSpace(channel); channel != "" {
+			if err := write("listen "+channel, false); err != nil {
+				writeJSON(w, http.StatusBadGateway, errorResponse{Error: err.Error()})
+				return
+			}
+		}
+	}
+	dialect := src.dialects[name]
+	if dialect.KeepaliveCommand != "" {
+		go func() {
+			ticker := time.NewTicker(rcon.DefaultKeepaliveInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					write(dialect.KeepaliveCommand, true)
+				}
+			}
+		}()
+	}
+
+	controller := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	controller.Flush()
+
+	packetChan := packet.CreateResponseChannel(client, ctx)
+	// closing the connection unblocks the pending read once the request goes away
+	stopReading := context.AfterFunc(ctx, func() { client.Close() })
+	defer func() {
+		stopReading()
+		cancel()
+		client.Close()
+		for range packetChan {
+		}
+	}()
+	for pkt := range packetChan {
+		if pkt.Error != nil {
+			if netErr, ok := pkt.Error.(net.Error); ok && netErr.Timeout() {
+				fmt.Fprint(w, ": keepalive\n\n")
+				controller.Flush()
+				continue
+			}
+			if ctx.Err() == nil {
+				logger.Warn.Printf("gateway: event stream to %v ended: %v", name, pkt.Error)
+			}
+			return
+		}
+		writeMu.Lock()
+		ignore := ignored[pkt.Id]
+		// the ID's response has arrived, it won't be seen again
+		delete(ignored, pkt.Id)
+		writeMu.Unlock()
+		if ignore || (dialect.Filter != nil && !dialect.Filter(pkt.RCONPacket)) {
+			continue
+		}
+		data, _ := json.Marshal(Event{Id: pkt.Id, Type: pkt.Type, Body: pkt.BodyStr()})
+		if _, err := fmt.Fprintf(w, "event: packet\ndata: %s\n\n", data); err != nil {
+			return
+		}
+		controller.Flush()
+	}
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "missing or invalid bearer token"})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,198 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/rcontest"
+)
+
+func startGateway(t *testing.T) (*rcontest.Server, *httptest.Server) {
+	t.Helper()
+	rconServer := rcontest.NewServer("secret")
+	t.Cleanup(rconServer.Close)
+	gateway, err := New(Config{
+		Tokens: []string{"admin-token"},
+		Servers: map[string]ServerConfig{
+			"eu1": {Address: rconServer.Addr, Password: "secret", Tokens: []string{"eu1-token"}},
+			"us1": {Address: rconServer.Addr, Password: "secret"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	t.Cleanup(func() { gateway.Close() })
+	httpServer := httptest.NewServer(gateway)
+	t.Cleanup(httpServer.Close)
+	return rconServer, httpServer
+}
+
+func request(t *testing.T, method, url, token, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("building request failed: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+func TestGatewayExec(t *testing.T) {
+	rconServer, httpServer := startGateway(t)
+	rconServer.Respond("playerlist", "Bob, 10 ms\n", "Alice, 20 ms\n")
+
+	res := request(t, http.MethodPost, httpServer.URL+"/servers/eu1/exec", "eu1-token", `{"command": "playerlist"}`)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status mismatch: got %d want %d", res.StatusCode, http.StatusOK)
+	}
+	var response ExecResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatalf("decoding response failed: %v", err)
+	}
+	if response.Body != "Bob, 10 ms\nAlice, 20 ms\n" {
+		t.Fatalf("body mismatch: got %q", response.Body)
+	}
+	if response.Id <= 0 {
+		t.Fatalf("expected a positive packet id, got %d", response.Id)
+	}
+}
+
+func TestGatewaySlowServerDoesNotBlockOthers(t *testing.T) {
+	rconServer := rcontest.NewServer("secret")
+	t.Cleanup(rconServer.Close)
+	rconServer.Respond("status", "ok")
+	// accepts connections but never answers the auth packet
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { silent.Close() })
+	go func() {
+		var cons []net.Conn
+		defer func() {
+			for _, con := range cons {
+				con.Close()
+			}
+		}()
+		for {
+			con, err := silent.Accept()
+			if err != nil {
+				return
+			}
+			cons = append(cons, con)
+		}
+	}()
+	gateway, err := New(Config{
+		Tokens:    []string{"admin-token"},
+		TimeoutMs: 3000,
+		Servers: map[string]ServerConfig{
+			"fast": {Address: rconServer.Addr, Password: "secret"},
+			"slow": {Address: silent.Addr().String(), Password: "secret"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	t.Cleanup(func() { gateway.Close() })
+	httpServer := httptest.NewServer(gateway)
+	t.Cleanup(httpServer.Close)
+
+	go func() {
+		req, _ := http.NewRequest(http.MethodPost, httpServer.URL+"/servers/slow/exec", strings.NewReader(`{"command": "status"}`))
+		req.Header.Set("Authorization", "Bearer admin-token")
+		if res, err := http.DefaultClient.Do(req); err == nil {
+			res.Body.Close()
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+	started := time.Now()
+	res := request(t, http.MethodPost, httpServer.URL+"/servers/fast/exec", "admin-token", `{"command": "status"}`)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status mismatch: got %d want %d", res.StatusCode, http.StatusOK)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Fatalf("fast server waited on the slow one: took %v", elapsed)
+	}
+}
+
+func TestGatewayAuthorization(t *testing.T) {
+	_, httpServer := startGateway(t)
+	cases := []struct {
+		path   string
+		token  string
+		status int
+	}{
+		{"/servers/eu1/exec", "", http.StatusUnauthorized},
+		{"/servers/eu1/exec", "wrong", http.StatusUnauthorized},
+		{"/servers/us1/exec", "eu1-token", http.StatusUnauthorized},
+		{"/servers/us1/exec", "admin-token", http.StatusOK},
+		{"/servers/nope/exec", "admin-token", http.StatusNotFound},
+	}
+	for _, c := range cases {
+		res := request(t, http.MethodPost, httpServer.URL+c.path, c.token, `{"command": "status"}`)
+		if res.StatusCode != c.status {
+			t.Fatalf("%v with token %q: status mismatch: got %d want %d", c.path, c.token, res.StatusCode, c.status)
+		}
+	}
+}
+
+func TestGatewayBadRequest(t *testing.T) {
+	_, httpServer := startGateway(t)
+	res := request(t, http.MethodPost, httpServer.URL+"/servers/eu1/exec", "admin-token", `not json`)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status mismatch: got %d want %d", res.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestGatewayEvents(t *testing.T) {
+	rconServer, httpServer := startGateway(t)
+	rconServer.Handle("listen", func(string) []string { return []string{"listening"} })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, httpServer.URL+"/servers/eu1/events?listen=chat", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer res.Body.Close()
+	if res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("content type mismatch: got %q", res.Header.Get("Content-Type"))
+	}
+	if !rconServer.WaitForCommand("listen chat", 5*time.Second) {
+		t.Fatal("listen command was not sent")
+	}
+	rconServer.Broadcast("Chat: Bob: hello")
+
+	scanner := bufio.NewScanner(res.Body)
+	var bodies []string
+	for scanner.Scan() && len(bodies) < 2 {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatalf("decoding event failed: %v", err)
+		}
+		bodies = append(bodies, event.Body)
+	}
+	if len(bodies) != 2 || bodies[0] != "listening" || bodies[1] != "Chat: Bob: hello" {
+		t.Fatalf("events mismatch: got %q", bodies)
+	}
+}
@@ -46,24 +46,64 @@ func (src RCONPacket) Serialize() []byte {
 	return bytesSlice
 }
 
-func readPacket(reader io.Reader) (RCONPacket, error) {
+const (
+	// MinPacketSize covers id, type and the two null terminators of an empty body
+	MinPacketSize uint32 = 10
+	// DefaultMaxPacketSize is generous compared to the 4096 bytes Valve servers send,
+	// non-compliant servers are known to exceed that
+	DefaultMaxPacketSize uint32 = 1 << 20
+)
+
+// Decoder reads packets from a stream, refusing size prefixes outside
+// [MinPacketSize, MaxPacketSize] before allocating anything.
+type Decoder struct {
+	reader        io.Reader
+	MaxPacketSize uint32
+}
+
+func NewDecoder(reader io.Reader) *Decoder {
+	return &Decoder{
+		reader:        reader,
+		MaxPacketSize: DefaultMaxPacketSize,
+	}
+}
+
+func (src *Decoder) Decode() (RCONPacket, error) {
 	dword := make([]byte, 4)
-	_, err := io.ReadFull(reader, dword)
+	_, err := io.ReadFull(src.reader, dword)
 	if err != nil {
 		return RCONPacket{}, err
 	}
 	packetSize := binary.LittleEndian.Uint32(dword)
+	if packetSize < MinPacketSize {
+		return RCONPacket{}, &ErrPacketTooSmall{Size: packetSize}
+	}
+	maxSize := src.MaxPacketSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxPacketSize
+	}
+	if packetSize > maxSize {
+		return RCONPacket{}, &ErrPacketTooLarge{Size: packetSize, Max: maxSize}
+	}
 	packetBytes := make([]byte, packetSize)
-	_, err = io.ReadFull(reader, packetBytes)
+	_, err = io.ReadFull(src.reader, packetBytes)
 	if err != nil {
 		return RCONPacket{}, err
 	}
 	id := int32(binary.LittleEndian.Uint32(packetBytes[0:4]))
 	packetType := int32(binary.LittleEndian.Uint32(packetBytes[4:8]))
+	terminator := [2]byte{packetBytes[packetSize-2], packetBytes[packetSize-1]}
+	if terminator != [2]byte{0, 0} {
+		return RCONPacket{}, &ErrMalformedTerminator{Id: id, Terminator: terminator}
+	}
 	body := bytes.TrimRight(packetBytes[8:], "\x00")
 	return New(id, packetType, body), nil
 }
 
+func readPacket(reader io.Reader) (RCONPacket, error) {
+	return NewDecoder(reader).Decode()
+}
+
 func ReadWithId(reader io.Reader, expectedId int32) (RCONPacket, error) {
 	pkt, err := readPacket(reader)
 	if err != nil {
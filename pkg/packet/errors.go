@@ -1,5 +1,37 @@
 package packet
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var ErrPacketIdMismatch error = errors.New("packet id mismatch")
+
+// ErrPacketTooLarge is returned when the size prefix exceeds the decoder's limit.
+type ErrPacketTooLarge struct {
+	Size uint32
+	Max  uint32
+}
+
+func (src *ErrPacketTooLarge) Error() string {
+	return fmt.Sprintf("packet size %v exceeds maximum of %v", src.Size, src.Max)
+}
+
+// ErrPacketTooSmall is returned when the size prefix can't even hold the id, type and terminators.
+type ErrPacketTooSmall struct {
+	Size uint32
+}
+
+func (src *ErrPacketTooSmall) Error() string {
+	return fmt.Sprintf("packet size %v is below minimum of %v", src.Size, MinPacketSize)
+}
+
+// ErrMalformedTerminator is returned when a packet doesn't end with the two null bytes.
+type ErrMalformedTerminator struct {
+	Id         int32
+	Terminator [2]byte
+}
+
+func (src *ErrMalformedTerminator) Error() string {
+	return fmt.Sprintf("packet %v has malformed terminator %#v, expected two null bytes", src.Id, src.Terminator)
+}
@@ -3,6 +3,7 @@ package packet
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"testing"
 )
 
@@ -145,3 +146,71 @@ func TestReadPacketEmptyBody(t *testing.T) {
 		t.Fatalf("body should be empty: got %v", pkt.Body)
 	}
 }
+
+func TestDecodePacketTooLarge(t *testing.T) {
+	packet := make([]byte, 4)
+	binary.LittleEndian.PutUint32(packet[0:4], 0xFFFFFFFF)
+
+	decoder := NewDecoder(bytes.NewReader(packet))
+	decoder.MaxPacketSize = 4096
+	_, err := decoder.Decode()
+
+	var tooLarge *ErrPacketTooLarge
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("expected ErrPacketTooLarge, got %v", err)
+	}
+	if tooLarge.Size != 0xFFFFFFFF || tooLarge.Max != 4096 {
+		t.Fatalf("error values mismatch: got size %d max %d", tooLarge.Size, tooLarge.Max)
+	}
+}
+
+func TestDecodePacketTooSmall(t *testing.T) {
+	// size 4 would previously make the id/type slicing panic
+	packet := make([]byte, 8)
+	binary.LittleEndian.PutUint32(packet[0:4], 4)
+
+	_, err := Read(bytes.NewReader(packet))
+
+	var tooSmall *ErrPacketTooSmall
+	if !errors.As(err, &tooSmall) {
+		t.Fatalf("expected ErrPacketTooSmall, got %v", err)
+	}
+	if tooSmall.Size != 4 {
+		t.Fatalf("error size mismatch: got %d want 4", tooSmall.Size)
+	}
+}
+
+func TestDecodePacketMalformedTerminator(t *testing.T) {
+	id := int32(7)
+	body := []byte("abc")
+	size := uint32(8 + len(body) + 2)
+	packet := make([]byte, 4+size)
+	binary.LittleEndian.PutUint32(packet[0:4], size)
+	binary.LittleEndian.PutUint32(packet[4:8], uint32(id))
+	binary.LittleEndian.PutUint32(packet[8:12], uint32(SERVERDATA_RESPONSE_VALUE))
+	copy(packet[12:], body)
+	packet[12+len(body)] = 0
+	packet[12+len(body)+1] = 'x'
+
+	_, err := Read(bytes.NewReader(packet))
+
+	var malformed *ErrMalformedTerminator
+	if !errors.As(err, &malformed) {
+		t.Fatalf("expected ErrMalformedTerminator, got %v", err)
+	}
+	if malformed.Id != id || malformed.Terminator != [2]byte{0, 'x'} {
+		t.Fatalf("error values mismatch: got id %d terminator %v", malformed.Id, malformed.Terminator)
+	}
+}
+
+func TestDecodeSerializedPacket(t *testing.T) {
+	original := New(5, SERVERDATA_EXECCOMMAND, []byte("playerlist"))
+	decoder := NewDecoder(bytes.NewReader(original.Serialize()))
+	decoded, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if decoded.Id != original.Id || decoded.Type != original.Type || decoded.BodyStr() != original.BodyStr() {
+		t.Fatalf("decoded packet mismatch: got %+v want %+v", decoded, original)
+	}
+}
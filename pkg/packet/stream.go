@@ -11,12 +11,14 @@ type StreamedPacket struct {
 	RCONPacket
 }
 
-type responseConn interface {
+// ResponseConn is what CreateResponseChannel reads packets from, e.g. a net.Conn or an
+// *rcon.Client before its reader starts.
+type ResponseConn interface {
 	io.Reader
 	SetReadDeadline(t time.Time) error
 }
 
-func CreateResponseChannel(con responseConn, ctx context.Context) <-chan StreamedPacket {
+func CreateResponseChannel(con ResponseConn, ctx context.Context) <-chan StreamedPacket {
 	packetChan := make(chan StreamedPacket)
 	stream := func() {
 		defer close(packetChan)
@@ -0,0 +1,482 @@
+// Package pool keeps a set of authenticated RCON connections for tools running many commands in parallel.
+package pool
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/logger"
+	"github.com/UltimateForm/tcprcon/pkg/rcon"
+)
+
+const (
+	defaultEvictionInterval = 30 * time.Second
+	defaultPingTimeout      = 5 * time.Second
+	defaultDialTimeout      = 10 * time.Second
+)
+
+var ErrPoolClosed error = errors.New("pool closed")
+
+type Config struct {
+	// MaxOpen caps connections in use and idle together, zero means no limit
+	MaxOpen int
+	// MinIdle connections are opened ahead of time and kept around by the evictor
+	MinIdle int
+	// MaxIdle connections are kept on release, extra ones are closed. Zero means no limit
+	MaxIdle int
+	// MaxLifetime closes connections that are older, zero means forever
+	MaxLifetime time.Duration
+	// MaxIdleTime closes connections left unused for longer, zero means forever
+	MaxIdleTime time.Duration
+	// PingCommand validates idle connections before handing them out, e.g. the dialect's
+	// keepalive command. Empty only checks the connection hasn't failed already
+	PingCommand string
+	PingTimeout time.Duration
+	DialTimeout time.Duration
+	// Dialer opens each connection, nil uses net.Dialer
+	Dialer rcon.Dialer
+	// EvictionInterval is how often idle connections are checked, defaults to 30 seconds
+	EvictionInterval time.Duration
+}
+
+type Stats struct {
+	InUse int
+	Idle  int
+	// Waits counts Get calls that had to queue for a connection, WaitDuration is their total wait
+	Waits        int64
+	WaitDuration time.Duration
+	Creations    int64
+	Discards     int64
+}
+
+type conn struct {
+	client   *rcon.Client
+	created  time.Time
+	returned time.Time
+}
+
+// Pool hands out authenticated clients up to Config.MaxOpen, callers queue in FIFO order once
+// the limit is reached. Every client from Get must go back through Release or Discard.
+type Pool struct {
+	address  string
+	password string
+	config   Config
+	opts     []rcon.Option
+
+	mu    sync.Mutex
+	idle  []*conn
+	inUse map[*rcon.Client]*conn
+	// opening counts connections being dialed, including slots handed to waiters
+	opening int
+	waiters []chan *conn
+	closed  bool
+	stats   Stats
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New creates a pool of clients for address and starts opening Config.MinIdle connections
+// in the background. opts are applied to every client, e.g. rcon.WithDialect.
+func New(address, password string, config Config, opts ...rcon.Option) *Pool {
+	pool := &Pool{
+		address:  address,
+		password: password,
+		config:   config,
+		opts:     opts,
+		inUse:    make(map[*rcon.Client]*conn),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go pool.evictor()
+	return pool
+}
+
+// Get returns an idle client, opens a new one under MaxOpen, or waits its turn until
+// one is released or ctx ends.
+func (src *Pool) Get(ctx context.Context) (*rcon.Client, error) {
+	var started time.Time
+	for {
+		src.mu.Lock()
+		if src.closed {
+			src.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+		// earlier waiters go first
+		if len(src.waiters) == 0 {
+			if n := len(src.idle); n > 0 {
+				c := src.idle[n-1]
+				src.idle = src.idle[:n-1]
+				src.inUse[c.client] = c
+				src.mu.Unlock()
+				if src.validate(ctx, c) {
+					return c.client, nil
+				}
+				logger.Debug.Printf("pool: discarding broken connection to %v", src.address)
+				src.Discard(c.client)
+				continue
+			}
+			if src.config.MaxOpen <= 0 || src.total() < src.config.MaxOpen {
+				src.opening++
+				src.mu.Unlock()
+				return src.openReserved(ctx)
+			}
+		}
+		waiter := make(chan *conn, 1)
+		src.waiters = append(src.waiters, waiter)
+		src.stats.Waits++
+		src.mu.Unlock()
+		if started.IsZero() {
+			started = time.Now()
+		}
+
+		select {
+		case c := <-waiter:
+			src.addWait(time.Since(started))
+			if c == nil {
+				// a slot was freed and reserved for us
+				return src.openReserved(ctx)
+			}
+			return c.client, nil
+		case <-ctx.Done():
+			src.abandon(waiter)
+			return nil, ctx.Err()
+		case <-src.stop:
+			src.abandon(waiter)
+			return nil, ErrPoolClosed
+		}
+	}
+}
+
+// Release returns client to the pool, handing it straight to the oldest waiter if any.
+func (src *Pool) Release(client *rcon.Client) {
+	src.mu.Lock()
+	c, ok := src.inUse[client]
+	if !ok {
+		src.mu.Unlock()
+		client.Close()
+		return
+	}
+	delete(src.inUse, client)
+	if src.closed || client.Err() != nil || src.expired(c, time.Now()) {
+		src.mu.Unlock()
+		src.discard(c)
+		return
+	}
+	c.returned = time.Now()
+	kept := src.put(c)
+	src.mu.Unlock()
+	if !kept {
+		src.discard(c)
+	}
+}
+
+// Discard closes client instead of returning it, e.g. after it failed a command.
+func (src *Pool) Discard(client *rcon.Client) {
+	src.mu.Lock()
+	c, ok := src.inUse[client]
+	delete(src.inUse, client)
+	src.mu.Unlock()
+	if !ok {
+		client.Close()
+		return
+	}
+	src.discard(c)
+}
+
+// WithClient runs fn with a pooled client, discarding the client if fn fails and releasing it otherwise.
+func (src *Pool) WithClient(ctx context.Context, fn func(*rcon.Client) error) error {
+	client, err := src.Get(ctx)
+	if err != nil {
+		return err
+	}
+	if err := fn(client); err != nil {
+		src.Discard(client)
+		return err
+	}
+	src.Release(client)
+	return nil
+}
+
+// Execute runs cmd on a pooled client, see WithClient.
+func (src *Pool) Execute(ctx context.Context, cmd string) (string, error) {
+	var response string
+	err := src.WithClient(ctx, func(client *rcon.Client) error {
+		var err error
+		response, err = client.Execute(ctx, cmd)
+		return err
+	})
+	return response, err
+}
+
+// ExecuteMulti runs cmd on a pooled client, see WithClient.
+func (src *Pool) ExecuteMulti(ctx context.Context, cmd string) (string, error) {
+	var response string
+	err := src.WithClient(ctx, func(client *rcon.Client) error {
+		var err error
+		response, err = client.ExecuteMulti(ctx, cmd)
+		return err
+	})
+	return response, err
+}
+
+func (src *Pool) Stats() Stats {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	stats := src.stats
+	stats.InUse = len(src.inUse)
+	stats.Idle = len(src.idle)
+	return stats
+}
+
+// Close closes every connection, including the ones in use, and fails pending Get calls.
+func (src *Pool) Close() error {
+	src.mu.Lock()
+	if src.closed {
+		src.mu.Unlock()
+		return nil
+	}
+	src.closed = true
+	conns := append([]*conn{}, src.idle...)
+	for _, c := range src.inUse {
+		conns = append(conns, c)
+	}
+	src.idle = nil
+	clear(src.inUse)
+	src.mu.Unlock()
+	close(src.stop)
+	<-src.done
+
+	var err error
+	for _, c := range conns {
+		err = errors.Join(err, c.client.Close())
+	}
+	logger.Debug.Printf("pool: closed %v connections to %v", len(conns), src.address)
+	return err
+}
+
+func (src *Pool) total() int {
+	return len(src.idle) + len(src.inUse) + src.opening
+}
+
+// put hands c to the oldest waiter or keeps it idle, reporting false when MaxIdle is reached.
+// Must be called with mu held
+func (src *Pool) put(c *conn) bool {
+	if len(src.waiters) > 0 {
+		waiter := src.waiters[0]
+		src.waiters = src.waiters[1:]
+		src.inUse[c.client] = c
+		waiter <- c
+		return true
+	}
+	if src.config.MaxIdle > 0 && len(src.idle) >= src.config.MaxIdle {
+		return false
+	}
+	src.idle = append(src.idle, c)
+	return true
+}
+
+// discard closes c and passes its slot on to the oldest waiter.
+func (src *Pool) discard(c *conn) {
+	c.client.Close()
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	src.stats.Discards++
+	src.freeSlot()
+}
+
+// freeSlot reserves a slot for the oldest waiter, who then opens its own connection.
+// Must be called with mu held
+func (src *Pool) freeSlot() {
+	if src.closed || len(src.waiters) == 0 {
+		return
+	}
+	waiter := src.waiters[0]
+	src.waiters = src.waiters[1:]
+	src.opening++
+	waiter <- nil
+}
+
+// abandon removes a waiter that gave up, passing on whatever it was handed in the meantime.
+func (src *Pool) abandon(waiter chan *conn) {
+	src.mu.Lock()
+	if i := slices.Index(src.waiters, waiter); i >= 0 {
+		src.waiters = slices.Delete(src.waiters, i, i+1)
+		src.mu.Unlock()
+		return
+	}
+	src.mu.Unlock()
+	c := <-waiter
+	if c != nil {
+		src.Release(c.client)
+		return
+	}
+	src.mu.Lock()
+	src.opening--
+	src.freeSlot()
+	src.mu.Unlock()
+}
+
+func (src *Pool) addWait(waited time.Duration) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	src.stats.WaitDuration += waited
+}
+
+// openReserved dials a connection for a slot already counted in opening.
+func (src *Pool) openReserved(ctx context.Context) (*rcon.Client, error) {
+	c, err := src.open(ctx)
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	src.opening--
+	if err != nil {
+		src.freeSlot()
+		return nil, err
+	}
+	if src.closed {
+		c.client.Close()
+		return nil, ErrPoolClosed
+	}
+	src.inUse[c.client] = c
+	return c.client, nil
+}
+
+func (src *Pool) open(ctx context.Context) (*conn, error) {
+	timeout := src.config.DialTimeout
+	if timeout <= 0 {
+		timeout = defaultDialTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	client, err := rcon.DialContext(ctx, src.config.Dialer, src.address, src.opts...)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := client.Authenticate(ctx, src.password)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	if !ok {
+		client.Close()
+		return nil, rcon.ErrAuthenticationFailed
+	}
+	now := time.Now()
+	src.mu.Lock()
+	src.stats.Creations++
+	src.mu.Unlock()
+	logger.Debug.Printf("pool: opened connection to %v", src.address)
+	return &conn{client: client, created: now, returned: now}, nil
+}
+
+func (src *Pool) validate(ctx context.Context, c *conn) bool {
+	if c.client.Err() != nil {
+		return false
+	}
+	if src.config.PingCommand == "" {
+		return true
+	}
+	timeout := src.config.PingTimeout
+	if timeout <= 0 {
+		timeout = defaultPingTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	_, err := c.client.Execute(ctx, src.config.PingCommand)
+	return err == nil
+}
+
+func (src *Pool) expired(c *conn, now time.Time) bool {
+	if src.config.MaxLifetime > 0 && now.Sub(c.created) >= src.config.MaxLifetime {
+		return true
+	}
+	return src.config.MaxIdleTime > 0 && now.Sub(c.returned) >= src.config.MaxIdleTime
+}
+
+// evictor closes expired idle connections and keeps MinIdle connections open.
+func (src *Pool) evictor() {
+	defer close(src.done)
+	interval := src.config.EvictionInterval
+	if interval <= 0 {
+		interval = defaultEvictionInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		src.evict()
+		src.fill()
+		select {
+		case <-src.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (src *Pool) evict() {
+	now := time.Now()
+	src.mu.Lock()
+	var evicted []*conn
+	kept := src.idle[:0]
+	for _, c := range src.idle {
+		if c.client.Err() != nil || src.expired(c, now) {
+			evicted = append(evicted, c)
+			continue
+		}
+		kept = append(kept, c)
+	}
+	clear(src.idle[len(kept):])
+	src.idle = kept
+	src.mu.Unlock()
+	for _, c := range evicted {
+		src.discard(c)
+	}
+	if len(evicted) > 0 {
+		logger.Debug.Printf("pool: evicted %v idle connections to %v", len(evicted), src.address)
+	}
+}
+
+func (src *Pool) fill() {
+	target := src.config.MinIdle
+	if src.config.MaxIdle > 0 {
+		target = min(target, src.config.MaxIdle)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-src.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	for {
+		src.mu.Lock()
+		if src.closed || len(src.idle)+src.opening >= target ||
+			(src.config.MaxOpen > 0 && src.total() >= src.config.MaxOpen) {
+			src.mu.Unlock()
+			return
+		}
+		src.opening++
+		src.mu.Unlock()
+
+		c, err := src.open(ctx)
+		src.mu.Lock()
+		src.opening--
+		if err != nil {
+			src.freeSlot()
+			src.mu.Unlock()
+			logger.Warn.Printf("pool: warming up connection to %v failed: %v", src.address, err)
+			return
+		}
+		kept := !src.closed && src.put(c)
+		src.mu.Unlock()
+		if !kept {
+			c.client.Close()
+			return
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/rcon"
+	"github.com/UltimateForm/tcprcon/pkg/rcontest"
+)
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %v", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPoolReusesConnections(t *testing.T) {
+	srv := rcontest.NewServer("secret")
+	defer srv.Close()
+	srv.Respond("status", "ok")
+	pool := New(srv.Addr, "secret", Config{MaxOpen: 2})
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for range 3 {
+		err := pool.WithClient(ctx, func(client *rcon.Client) error {
+			_, err := client.Execute(ctx, "status")
+			return err
+		})
+		if err != nil {
+			t.Fatalf("WithClient failed: %v", err)
+		}
+	}
+	stats := pool.Stats()
+	if stats.Creations != 1 {
+		t.Fatalf("creations mismatch: got %v want %v", stats.Creations, 1)
+	}
+	if stats.Idle != 1 || stats.InUse != 0 {
+		t.Fatalf("idle/in-use mismatch: got %v/%v want 1/0", stats.Idle, stats.InUse)
+	}
+}
+
+// countingDialer counts the connections it opens
+type countingDialer struct {
+	net.Dialer
+	dials atomic.Int32
+}
+
+func (src *countingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	src.dials.Add(1)
+	return src.Dialer.DialContext(ctx, network, address)
+}
+
+func TestPoolExecuteWithDialer(t *testing.T) {
+	srv := rcontest.NewServer("secret")
+	defer srv.Close()
+	srv.Respond("status", "ok")
+	dialer := &countingDialer{}
+	var executor rcon.Executor = New(srv.Addr, "secret", Config{MaxOpen: 1, Dialer: dialer})
+	defer executor.(*Pool).Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for range 2 {
+		response, err := executor.Execute(ctx, "status")
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		if response != "ok" {
+			t.Fatalf("response mismatch: got %q want %q", response, "ok")
+		}
+	}
+	if dialer.dials.Load() != 1 {
+		t.Fatalf("dial count mismatch: got %v want %v", dialer.dials.Load(), 1)
+	}
+}
+
+func TestPoolWaitersAreServedInOrder(t *testing.T) {
+	srv := rcontest.NewServer("secret")
+	defer srv.Close()
+	pool := New(srv.Addr, "secret", Config{MaxOpen: 1})
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	held, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	order := make(chan int, 3)
+	for i := range 3 {
+		go func() {
+			client, err := pool.Get(ctx)
+			if err != nil {
+				t.Errorf("waiter %v failed: %v", i, err)
+				return
+			}
+			order <- i
+			pool.Release(client)
+		}()
+		// queue the waiters one after the other
+		waitFor(t, "waiter to queue", func() bool { return pool.Stats().Waits == int64(i+1) })
+	}
+	pool.Release(held)
+	for want := range 3 {
+		select {
+		case got := <-order:
+			if got != want {
+				t.Fatalf("waiter order mismatch: got %v want %v", got, want)
+			}
+		case <-ctx.Done():
+			t.Fatal("waiters were not served")
+		}
+	}
+	stats := pool.Stats()
+	if stats.Creations != 1 {
+		t.Fatalf("creations mismatch: got %v want %v", stats.Creations, 1)
+	}
+	if stats.WaitDuration <= 0 {
+		t.Fatal("expected wait duration to be recorded")
+	}
+}
+
+func TestPoolGetHonoursContext(t *testing.T) {
+	srv := rcontest.NewServer("secret")
+	defer srv.Close()
+	pool := New(srv.Addr, "secret", Config{MaxOpen: 1})
+	defer pool.Close()
+
+	held, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Get(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+	// the abandoned waiter must not hold on to the slot
+	pool.Release(held)
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatalf("Get after abandoned waiter failed: %v", err)
+	}
+	pool.Release(client)
+}
+
+func TestPoolDiscardFreesSlotForWaiter(t *testing.T) {
+	srv := rcontest.NewServer("secret")
+	defer srv.Close()
+	pool := New(srv.Addr, "secret", Config{MaxOpen: 1})
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	held, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	result := make(chan error, 1)
+	go func() {
+		client, err := pool.Get(ctx)
+		if err == nil {
+			pool.Release(client)
+		}
+		result <- err
+	}()
+	waitFor(t, "waiter to queue", func() bool { return pool.Stats().Waits == 1 })
+	pool.Discard(held)
+	if err := <-result; err != nil {
+		t.Fatalf("waiter failed: %v", err)
+	}
+	stats := pool.Stats()
+	if stats.Creations != 2 || stats.Discards != 1 {
+		t.Fatalf("creations/discards mismatch: got %v/%v want 2/1", stats.Creations, stats.Discards)
+	}
+}
+
+func TestPoolValidatesOnBorrow(t *testing.T) {
+	srv := rcontest.NewServer("secret")
+	defer srv.Close()
+	srv.Respond("echo", "")
+	pool := New(srv.Addr, "secret", Config{PingCommand: "echo", PingTimeout: time.Second})
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	pool.Release(client)
+	// the idle client has no reader running, only the ping notices the dropped connection
+	srv.CloseClientConnections()
+
+	fresh, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if fresh == client {
+		t.Fatal("expected the broken connection to be replaced")
+	}
+	if discards := pool.Stats().Discards; discards != 1 {
+		t.Fatalf("discards mismatch: got %v want %v", discards, 1)
+	}
+	pool.Release(fresh)
+
+	// healthy idle connections are pinged and handed out again
+	again, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	defer pool.Release(again)
+	if again != fresh {
+		t.Fatal("expected the healthy connection to be reused")
+	}
+	srv.AssertReceived(t, "echo")
+}
+
+func TestPoolWarmsUpAndEvicts(t *testing.T) {
+	srv := rcontest.NewServer("secret")
+	defer srv.Close()
+	pool := New(srv.Addr, "secret", Config{
+		MinIdle:          2,
+		MaxLifetime:      50 * time.Millisecond,
+		EvictionInterval: 20 * time.Millisecond,
+	})
+	defer pool.Close()
+
+	waitFor(t, "warmup", func() bool { return pool.Stats().Idle == 2 })
+	// expired connections get replaced to keep MinIdle around
+	waitFor(t, "eviction", func() bool {
+		stats := pool.Stats()
+		return stats.Discards >= 2 && stats.Idle == 2
+	})
+}
+
+func TestPoolCloseClosesInUseClients(t *testing.T) {
+	srv := rcontest.NewServer("secret")
+	defer srv.Close()
+	pool := New(srv.Addr, "secret", Config{MaxOpen: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	waiting := make(chan error, 1)
+	go func() {
+		_, err := pool.Get(ctx)
+		waiting <- err
+	}()
+	waitFor(t, "waiter to queue", func() bool { return pool.Stats().Waits == 1 })
+	pool.Close()
+
+	if err := <-waiting; !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("expected ErrPoolClosed for waiter, got %v", err)
+	}
+	if _, err := client.Execute(ctx, "status"); err == nil {
+		t.Fatal("expected in-use client to be closed")
+	}
+	if _, err := pool.Get(ctx); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("expected ErrPoolClosed, got %v", err)
+	}
+	pool.Release(client)
+}
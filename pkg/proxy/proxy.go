@@ -0,0 +1,117 @@
+// Package proxy lets many RCON tools share a single authenticated upstream connection.
+package proxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/logger"
+	"github.com/UltimateForm/tcprcon/pkg/packet"
+	"github.com/UltimateForm/tcprcon/pkg/rcon"
+	"github.com/UltimateForm/tcprcon/pkg/rcon/server"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// ErrServerClosed is returned by Serve and ListenAndServe once the upstream connection
+// ended or the proxy was shut down.
+var ErrServerClosed error = server.ErrServerClosed
+
+type upstream interface {
+	rcon.Executor
+	Broadcasts() <-chan packet.RCONPacket
+}
+
+// Proxy accepts downstream RCON clients and runs their commands over one upstream client.
+// The upstream client allocates its own packet IDs, so downstream IDs never collide and
+// each downstream still gets its responses under the IDs it sent. Broadcasts received
+// upstream are fanned out to every authenticated downstream session.
+type Proxy struct {
+	// Passwords accepted from downstream clients, independent from the upstream password
+	Passwords []string
+	// Timeout bounds each upstream command, defaults to 30 seconds
+	Timeout time.Duration
+
+	upstream   upstream
+	server     *server.Server
+	fanOutOnce sync.Once
+}
+
+// New builds a proxy over an already authenticated upstream client such as *rcon.Client.
+func New(upstream upstream, passwords ...string) *Proxy {
+	proxy := &Proxy{
+		Passwords: passwords,
+		Timeout:   defaultTimeout,
+		upstream:  upstream,
+	}
+	proxy.server = &server.Server{
+		Handler: server.HandlerFunc(proxy.serveRCON),
+		Auth:    proxy.authenticate,
+	}
+	return proxy
+}
+
+func (src *Proxy) ListenAndServe(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return src.Serve(listener)
+}
+
+// Serve accepts downstream connections on listener until the upstream connection ends,
+// Shutdown or Close is called. It may be called for several listeners, broadcasts reach
+// the sessions of all of them.
+func (src *Proxy) Serve(listener net.Listener) error {
+	src.fanOutOnce.Do(func() { go src.fanOut() })
+	return src.server.Serve(listener)
+}
+
+func (src *Proxy) Shutdown(ctx context.Context) error {
+	return src.server.Shutdown(ctx)
+}
+
+func (src *Proxy) Close() error {
+	return src.server.Close()
+}
+
+func (src *Proxy) authenticate(ctx context.Context, password string) bool {
+	for _, accepted := range src.Passwords {
+		if subtle.ConstantTimeCompare([]byte(accepted), []byte(password)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (src *Proxy) serveRCON(w server.ResponseWriter, r *server.Request) {
+	timeout := src.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	logger.Debug.Printf("proxy: %v -> %q", r.RemoteAddr, r.Command)
+	response, err := src.upstream.ExecuteMulti(ctx, r.Command)
+	if err != nil {
+		logger.Err.Printf("proxy: upstream failed to execute %q for %v: %v", r.Command, r.RemoteAddr, err)
+		fmt.Fprintf(w, "proxy: upstream error: %v", err)
+		return
+	}
+	w.WriteString(response)
+}
+
+// fanOut relays upstream broadcasts until the upstream connection ends, then closes
+// the downstream sessions so their tools notice and reconnect.
+func (src *Proxy) fanOut() {
+	for pkt := range src.upstream.Broadcasts() {
+		sent := src.server.BroadcastPacket(pkt)
+		logger.Debug.Printf("proxy: relayed broadcast %v to %v sessions", pkt.Id, sent)
+	}
+	logger.Warn.Println("proxy: upstream connection ended, closing downstream sessions")
+	src.server.Close()
+}
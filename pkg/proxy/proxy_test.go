@@ -0,0 +1,162 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/packet"
+	"github.com/UltimateForm/tcprcon/pkg/rcon"
+	"github.com/UltimateForm/tcprcon/pkg/rcontest"
+)
+
+func dial(t *testing.T, address, password string) *rcon.Client {
+	t.Helper()
+	client, err := rcon.New(address)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	ok, err := client.Authenticate(context.Background(), password)
+	if err != nil || !ok {
+		t.Fatalf("Authenticate failed: %v %v", ok, err)
+	}
+	return client
+}
+
+func startProxy(t *testing.T) (*rcontest.Server, string) {
+	t.Helper()
+	upstreamServer := rcontest.NewServer("upstream-secret")
+	t.Cleanup(upstreamServer.Close)
+	upstreamServer.Handle("echo", func(cmd string) []string {
+		return []string{cmd}
+	})
+	upstream := dial(t, upstreamServer.Addr, "upstream-secret")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	proxy := New(upstream, "bot-secret", "dashboard-secret")
+	go proxy.Serve(listener)
+	t.Cleanup(func() { proxy.Close() })
+	return upstreamServer, listener.Addr().String()
+}
+
+func TestProxyMultiplexesDownstreamClients(t *testing.T) {
+	upstreamServer, address := startProxy(t)
+	bot := dial(t, address, "bot-secret")
+	dashboard := dial(t, address, "dashboard-secret")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 10; i++ {
+		for name, client := range map[string]*rcon.Client{"bot": bot, "dashboard": dashboard} {
+			wg.Add(1)
+			go func(client *rcon.Client, cmd string) {
+				defer wg.Done()
+				response, err := client.Execute(ctx, cmd)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if response != cmd {
+					errs <- fmt.Errorf("response mismatch: got %q want %q", response, cmd)
+				}
+			}(client, fmt.Sprintf("echo %v %d", name, i))
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if upstreamServer.Sessions() != 1 {
+		t.Fatalf("upstream sessions mismatch: got %d want 1", upstreamServer.Sessions())
+	}
+}
+
+func TestProxyRejectsUnknownPassword(t *testing.T) {
+	_, address := startProxy(t)
+	client, err := rcon.New(address)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer client.Close()
+	ok, err := client.Authenticate(context.Background(), "upstream-secret")
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if ok {
+		t.Fatal("the upstream password must not be accepted downstream")
+	}
+}
+
+func TestProxyFansOutBroadcasts(t *testing.T) {
+	upstreamServer, address := startProxy(t)
+	bot := dial(t, address, "bot-secret")
+	dashboard := dial(t, address, "dashboard-secret")
+	botEvents, dashboardEvents := bot.Broadcasts(), dashboard.Broadcasts()
+	// make sure both downstream sessions are authenticated on the proxy
+	bot.Execute(context.Background(), "echo ready")
+	dashboard.Execute(context.Background(), "echo ready")
+
+	upstreamServer.Broadcast("Killfeed: Bob killed Alice")
+	for name, events := range map[string]<-chan packet.RCONPacket{"bot": botEvents, "dashboard": dashboardEvents} {
+		select {
+		case pkt := <-events:
+			if pkt.BodyStr() != "Killfeed: Bob killed Alice" {
+				t.Fatalf("%v broadcast mismatch: got %q", name, pkt.BodyStr())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%v did not receive the broadcast", name)
+		}
+	}
+}
+
+func TestProxyFansOutToEveryListener(t *testing.T) {
+	upstreamServer := rcontest.NewServer("upstream-secret")
+	t.Cleanup(upstreamServer.Close)
+	upstreamServer.Respond("echo", "ready")
+	upstreamServer.BroadcastId = 777
+	proxy := New(dial(t, upstreamServer.Addr, "upstream-secret"), "secret")
+	t.Cleanup(func() { proxy.Close() })
+
+	var downstream []*rcon.Client
+	for range 2 {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen failed: %v", err)
+		}
+		go proxy.Serve(listener)
+		client := dial(t, listener.Addr().String(), "secret")
+		client.Execute(context.Background(), "echo")
+		downstream = append(downstream, client)
+	}
+	events := []<-chan packet.RCONPacket{downstream[0].Broadcasts(), downstream[1].Broadcasts()}
+
+	const count = 20
+	for i := range count {
+		upstreamServer.Broadcast(fmt.Sprintf("Chat: message %v", i))
+	}
+	for listener, events := range events {
+		for i := range count {
+			select {
+			case pkt := <-events:
+				if want := fmt.Sprintf("Chat: message %v", i); pkt.BodyStr() != want {
+					t.Fatalf("listener %v broadcast mismatch: got %q want %q", listener, pkt.BodyStr(), want)
+				}
+				if pkt.Id != 777 || pkt.Type != packet.SERVERDATA_RESPONSE_VALUE {
+					t.Fatalf("listener %v packet mismatch: got id %v type %v want id 777", listener, pkt.Id, pkt.Type)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("listener %v did not receive broadcast %v", listener, i)
+			}
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package query
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// Info is the A2S_INFO response.
+type Info struct {
+	Protocol    byte
+	Name        string
+	Map         string
+	Folder      string
+	Game        string
+	AppID       uint16
+	Players     int
+	MaxPlayers  int
+	Bots        int
+	ServerType  byte // 'd' dedicated, 'l' listen, 'p' SourceTV
+	Environment byte // 'l' Linux, 'w' Windows, 'm' or 'o' macOS
+	Private     bool
+	VAC         bool
+	Version     string
+	// the fields below are only set when the server sends them
+	Port     uint16
+	SteamID  uint64
+	SourceTV *SourceTV
+	Keywords string
+	GameID   uint64
+}
+
+type SourceTV struct {
+	Port uint16
+	Name string
+}
+
+// Player is an entry of the A2S_PLAYER response.
+type Player struct {
+	Index    byte
+	Name     string
+	Score    int32
+	Duration time.Duration
+}
+
+const (
+	edfPort     = 0x80
+	edfSteamID  = 0x10
+	edfSourceTV = 0x40
+	edfKeywords = 0x20
+	edfGameID   = 0x01
+	// The Ship appends game mode, witnesses and duration before the version
+	appIDTheShip = 2400
+)
+
+// reader decodes little endian fields, the first failure sticks and later reads are zero
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (src *reader) take(n int) []byte {
+	if src.err != nil || len(src.data) < n {
+		src.err = ErrInvalidResponse
+		return make([]byte, n)
+	}
+	out := src.data[:n]
+	src.data = src.data[n:]
+	return out
+}
+
+func (src *reader) byte() byte {
+	return src.take(1)[0]
+}
+
+func (src *reader) uint16() uint16 {
+	return binary.LittleEndian.Uint16(src.take(2))
+}
+
+func (src *reader) uint32() uint32 {
+	return binary.LittleEndian.Uint32(src.take(4))
+}
+
+func (src *reader) uint64() uint64 {
+	return binary.LittleEndian.Uint64(src.take(8))
+}
+
+func (src *reader) string() string {
+	if src.err != nil {
+		return ""
+	}
+	end := bytes.IndexByte(src.data, 0)
+	if end < 0 {
+		src.err = ErrInvalidResponse
+		return ""
+	}
+	out := string(src.data[:end])
+	src.data = src.data[end+1:]
+	return out
+}
+
+func (src *reader) more() bool {
+	return src.err == nil && len(src.data) > 0
+}
+
+func parseInfo(body []byte) (*Info, error) {
+	r := &reader{data: body}
+	info := &Info{
+		Protocol: r.byte(),
+		Name:     r.string(),
+		Map:      r.string(),
+		Folder:   r.string(),
+		Game:     r.string(),
+		AppID:    r.uint16(),
+	}
+	info.Players = int(r.byte())
+	info.MaxPlayers = int(r.byte())
+	info.Bots = int(r.byte())
+	info.ServerType = r.byte()
+	info.Environment = r.byte()
+	info.Private = r.byte() == 1
+	info.VAC = r.byte() == 1
+	if info.AppID == appIDTheShip {
+		r.take(3)
+	}
+	info.Version = r.string()
+	if r.more() {
+		edf := r.byte()
+		if edf&edfPort != 0 {
+			info.Port = r.uint16()
+		}
+		if edf&edfSteamID != 0 {
+			info.SteamID = r.uint64()
+		}
+		if edf&edfSourceTV != 0 {
+			info.SourceTV = &SourceTV{Port: r.uint16(), Name: r.string()}
+		}
+		if edf&edfKeywords != 0 {
+			info.Keywords = r.string()
+		}
+		if edf&edfGameID != 0 {
+			info.GameID = r.uint64()
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return info, nil
+}
+
+func parsePlayers(body []byte) ([]Player, error) {
+	r := &reader{data: body}
+	count := int(r.byte())
+	players := make([]Player, 0, count)
+	// the count wraps past 255 players, so read until the data runs out
+	for r.more() {
+		player := Player{
+			Index: r.byte(),
+			Name:  r.string(),
+			Score: int32(r.uint32()),
+		}
+		seconds := math.Float32frombits(r.uint32())
+		player.Duration = time.Duration(float64(seconds) * float64(time.Second))
+		if r.err != nil {
+			break
+		}
+		players = append(players, player)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return players, nil
+}
+
+func parseRules(body []byte) (map[string]string, error) {
+	r := &reader{data: body}
+	count := int(r.uint16())
+	rules := make(map[string]string, count)
+	for r.more() {
+		name, value := r.string(), r.string()
+		if r.err != nil {
+			break
+		}
+		rules[name] = value
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return rules, nil
+}
@@ -0,0 +1,296 @@
+// Package query implements the Source server query protocol (A2S_INFO, A2S_PLAYER and
+// A2S_RULES over UDP), which needs no password.
+package query
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/logger"
+)
+
+const (
+	DefaultTimeout = 5 * time.Second
+	maxDatagram    = 65535
+	// servers may keep asking for a new challenge, give up after this many
+	maxChallenges = 3
+
+	headerSingle uint32 = 0xFFFFFFFF
+	headerSplit  uint32 = 0xFFFFFFFE
+
+	requestInfo    byte = 'T'
+	requestPlayers byte = 'U'
+	requestRules   byte = 'V'
+
+	responseChallenge byte = 'A'
+	responseInfo      byte = 'I'
+	responsePlayers   byte = 'D'
+	responseRules     byte = 'E'
+)
+
+var (
+	ErrInvalidResponse   error = errors.New("invalid query response")
+	ErrChecksumMismatch  error = errors.New("decompressed query response checksum mismatch")
+	ErrTooManyChallenges error = errors.New("server kept sending challenges")
+	ErrNoResponse        error = errors.New("server did not respond")
+)
+
+// Client queries a single server, requests run one at a time.
+type Client struct {
+	Address string
+	// Timeout bounds each request when ctx has no earlier deadline
+	Timeout time.Duration
+
+	con net.Conn
+	mu  sync.Mutex
+}
+
+// New dials address over UDP, usually the game port.
+func New(address string) (*Client, error) {
+	con, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromConn(address, con), nil
+}
+
+func NewFromConn(address string, con net.Conn) *Client {
+	return &Client{Address: address, Timeout: DefaultTimeout, con: con}
+}
+
+func (src *Client) Close() error {
+	return src.con.Close()
+}
+
+// Info sends A2S_INFO.
+func (src *Client) Info(ctx context.Context) (*Info, error) {
+	payload := append([]byte("Source Engine Query"), 0)
+	body, err := src.request(ctx, requestInfo, payload, responseInfo, false)
+	if err != nil {
+		return nil, err
+	}
+	return parseInfo(body)
+}
+
+// Players sends A2S_PLAYER.
+func (src *Client) Players(ctx context.Context) ([]Player, error) {
+	body, err := src.request(ctx, requestPlayers, nil, responsePlayers, true)
+	if err != nil {
+		return nil, err
+	}
+	return parsePlayers(body)
+}
+
+// Rules sends A2S_RULES.
+func (src *Client) Rules(ctx context.Context) (map[string]string, error) {
+	body, err := src.request(ctx, requestRules, nil, responseRules, true)
+	if err != nil {
+		return nil, err
+	}
+	return parseRules(body)
+}
+
+// request sends kind and answers challenges until a response of type want arrives.
+// A2S_PLAYER and A2S_RULES always carry a challenge, -1 asks the server for one.
+func (src *Client) request(ctx context.Context, kind byte, payload []byte, want byte, challenged bool) ([]byte, error) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	stop := context.AfterFunc(ctx, func() {
+		src.con.SetReadDeadline(time.Now())
+	})
+	defer stop()
+	timeout := src.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	var challenge []byte
+	if challenged {
+		challenge = []byte{0xFF, 0xFF, 0xFF, 0xFF}
+	}
+	for range maxChallenges + 1 {
+		out := binary.LittleEndian.AppendUint32(nil, headerSingle)
+		out = append(out, kind)
+		out = append(out, payload...)
+		out = append(out, challenge...)
+		src.drain()
+		if _, err := src.con.Write(out); err != nil {
+			return nil, err
+		}
+		body, err := src.receive(ctx, deadline)
+		if err != nil {
+			return nil, err
+		}
+		if len(body) == 0 {
+			return nil, ErrInvalidResponse
+		}
+		switch body[0] {
+		case want:
+			return body[1:], nil
+		case responseChallenge:
+			if len(body) < 5 {
+				return nil, ErrInvalidResponse
+			}
+			challenge = bytes.Clone(body[1:5])
+		default:
+			return nil, fmt.Errorf("%w: unexpected response type %q", ErrInvalidResponse, body[0])
+		}
+	}
+	return nil, ErrTooManyChallenges
+}
+
+// drain discards datagrams left over from earlier requests, such as a reply that arrived
+// after its request timed out. An expired deadline fails before reading, so a short one
+// lets queued datagrams through
+func (src *Client) drain() {
+	buf := make([]byte, maxDatagram)
+	for {
+		src.con.SetReadDeadline(time.Now().Add(time.Millisecond))
+		n, err := src.con.Read(buf)
+		if err != nil {
+			return
+		}
+		logger.Debug.Printf("query: discarding %v stale bytes from %v", n, src.Address)
+	}
+}
+
+// receive reads one response, reassembling split packets
+func (src *Client) receive(ctx context.Context, deadline time.Time) ([]byte, error) {
+	buf := make([]byte, maxDatagram)
+	var split *splitResponse
+	for {
+		src.con.SetReadDeadline(deadline)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		n, err := src.con.Read(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, ErrNoResponse
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n < 4 {
+			continue
+		}
+		switch binary.LittleEndian.Uint32(buf) {
+		case headerSingle:
+			return bytes.Clone(buf[4:n]), nil
+		case headerSplit:
+			part, err := parseSplit(buf[4:n])
+			if err != nil {
+				return nil, err
+			}
+			if split == nil || split.id != part.id {
+				split = &splitResponse{id: part.id, parts: make([][]byte, part.total)}
+			}
+			done, err := split.add(part)
+			if err != nil {
+				return nil, err
+			}
+			if done {
+				return split.assemble()
+			}
+		default:
+			logger.Debug.Printf("query: dropping datagram with unknown header from %v", src.Address)
+		}
+	}
+}
+
+type splitPart struct {
+	id         int32
+	total      int
+	number     int
+	size       uint32
+	checksum   uint32
+	compressed bool
+	payload    []byte
+}
+
+// parseSplit reads a Source split packet header: id, total, number, max packet size and,
+// on the first packet of a compressed response, the decompressed size and CRC32
+func parseSplit(data []byte) (splitPart, error) {
+	if len(data) < 8 {
+		return splitPart{}, ErrInvalidResponse
+	}
+	part := splitPart{
+		id:         int32(binary.LittleEndian.Uint32(data)),
+		total:      int(data[4]),
+		number:     int(data[5]),
+		compressed: binary.LittleEndian.Uint32(data)&0x80000000 != 0,
+	}
+	data = data[8:]
+	if part.total == 0 || part.number >= part.total {
+		return splitPart{}, fmt.Errorf("%w: split packet %v of %v", ErrInvalidResponse, part.number, part.total)
+	}
+	if part.compressed && part.number == 0 {
+		if len(data) < 8 {
+			return splitPart{}, ErrInvalidResponse
+		}
+		part.size = binary.LittleEndian.Uint32(data)
+		part.checksum = binary.LittleEndian.Uint32(data[4:])
+		data = data[8:]
+	}
+	part.payload = bytes.Clone(data)
+	return part, nil
+}
+
+type splitResponse struct {
+	id         int32
+	parts      [][]byte
+	received   int
+	compressed bool
+	size       uint32
+	checksum   uint32
+}
+
+func (src *splitResponse) add(part splitPart) (bool, error) {
+	if part.total != len(src.parts) {
+		return false, fmt.Errorf("%w: split packet count changed", ErrInvalidResponse)
+	}
+	if src.parts[part.number] != nil {
+		return false, nil
+	}
+	if part.number == 0 {
+		src.compressed, src.size, src.checksum = part.compressed, part.size, part.checksum
+	}
+	src.parts[part.number] = part.payload
+	src.received++
+	return src.received == len(src.parts), nil
+}
+
+// assemble joins the parts and strips the inner -1 header, decompressing bzip2 payloads
+func (src *splitResponse) assemble() ([]byte, error) {
+	body := bytes.Join(src.parts, nil)
+	if src.compressed {
+		decompressed, err := io.ReadAll(io.LimitReader(bzip2.NewReader(bytes.NewReader(body)), int64(src.size)+1))
+		if err != nil {
+			return nil, errors.Join(ErrInvalidResponse, err)
+		}
+		if uint32(len(decompressed)) != src.size || crc32.ChecksumIEEE(decompressed) != src.checksum {
+			return nil, ErrChecksumMismatch
+		}
+		body = decompressed
+	}
+	if len(body) < 4 || binary.LittleEndian.Uint32(body) != headerSingle {
+		return nil, fmt.Errorf("%w: reassembled response lacks a header", ErrInvalidResponse)
+	}
+	return body[4:], nil
+}
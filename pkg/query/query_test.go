@@ -0,0 +1,238 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+var testChallenge = []byte{0x11, 0x22, 0x33, 0x44}
+
+// rulesBody is an A2S_RULES response with mp_timelimit=30 and sv_gravity=800,
+// rulesCompressed is the same body compressed with bzip2
+var (
+	rulesBody          = []byte("\xff\xff\xff\xffE\x02\x00mp_timelimit\x0030\x00sv_gravity\x00800\x00")
+	rulesCompressed, _ = hex.DecodeString("425a68393141592653596ab869400000134f80d000484002000000a2a65d200000a0002211a0d003ca14c269a034c4e8329a3d62eea7c06b41a9d096908b3c09b85a7c5dc914e14241aae1a500")
+)
+
+func infoBody() []byte {
+	body := []byte("\xff\xff\xff\xffI\x11")
+	body = append(body, "Test Server\x00de_dust2\x00cstrike\x00Counter-Strike\x00"...)
+	body = binary.LittleEndian.AppendUint16(body, 240)
+	body = append(body, 12, 32, 2, 'd', 'l', 0, 1)
+	body = append(body, "1.0.0.1\x00"...)
+	body = append(body, edfPort|edfKeywords)
+	body = binary.LittleEndian.AppendUint16(body, 27015)
+	body = append(body, "secure,casual\x00"...)
+	return body
+}
+
+func playersBody() []byte {
+	body := []byte("\xff\xff\xff\xffD\x02")
+	for i, name := range []string{"Alice", "Bob"} {
+		body = append(body, byte(i))
+		body = append(body, name+"\x00"...)
+		body = binary.LittleEndian.AppendUint32(body, uint32(int32(10*(i+1))))
+		body = binary.LittleEndian.AppendUint32(body, math.Float32bits(90.5))
+	}
+	return body
+}
+
+// split cuts body into parts with Source split headers, compressed bodies carry the
+// decompressed size and CRC32 of plain on the first part
+func split(id uint32, body []byte, parts int, plain []byte) [][]byte {
+	var out [][]byte
+	size := (len(body) + parts - 1) / parts
+	for number := range parts {
+		chunk := body[min(number*size, len(body)):min((number+1)*size, len(body))]
+		packet := binary.LittleEndian.AppendUint32(nil, headerSplit)
+		packet = binary.LittleEndian.AppendUint32(packet, id)
+		packet = append(packet, byte(parts), byte(number))
+		packet = binary.LittleEndian.AppendUint16(packet, 1248)
+		if plain != nil && number == 0 {
+			packet = binary.LittleEndian.AppendUint32(packet, uint32(len(plain)))
+			packet = binary.LittleEndian.AppendUint32(packet, crc32.ChecksumIEEE(plain))
+		}
+		out = append(out, append(packet, chunk...))
+	}
+	return out
+}
+
+func newFakeServer(t *testing.T) string {
+	t.Helper()
+	con, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { con.Close() })
+	go func() {
+		buf := make([]byte, maxDatagram)
+		for {
+			n, addr, err := con.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			request := buf[:n]
+			if len(request) < 5 {
+				continue
+			}
+			if !bytes.HasSuffix(request, testChallenge) {
+				con.WriteTo(append([]byte("\xff\xff\xff\xffA"), testChallenge...), addr)
+				continue
+			}
+			var replies [][]byte
+			switch request[4] {
+			case requestInfo:
+				replies = [][]byte{infoBody()}
+			case requestPlayers:
+				// delivered out of order
+				parts := split(7, playersBody(), 2, nil)
+				replies = [][]byte{parts[1], parts[0]}
+			case requestRules:
+				replies = split(8|0x80000000, rulesCompressed, 3, rulesBody)
+			}
+			for _, reply := range replies {
+				con.WriteTo(reply, addr)
+			}
+		}
+	}()
+	return con.LocalAddr().String()
+}
+
+func dial(t *testing.T, address string) *Client {
+	t.Helper()
+	client, err := New(address)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestInfo(t *testing.T) {
+	client := dial(t, newFakeServer(t))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	info, err := client.Info(ctx)
+	if err != nil {
+		t.Fatalf("Info failed: %v", err)
+	}
+	want := Info{
+		Protocol: 0x11, Name: "Test Server", Map: "de_dust2", Folder: "cstrike", Game: "Counter-Strike",
+		AppID: 240, Players: 12, MaxPlayers: 32, Bots: 2, ServerType: 'd', Environment: 'l',
+		VAC: true, Version: "1.0.0.1", Port: 27015, Keywords: "secure,casual",
+	}
+	if *info != want {
+		t.Fatalf("info mismatch: got %+v want %+v", *info, want)
+	}
+}
+
+func TestPlayersSplit(t *testing.T) {
+	client := dial(t, newFakeServer(t))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	players, err := client.Players(ctx)
+	if err != nil {
+		t.Fatalf("Players failed: %v", err)
+	}
+	if len(players) != 2 {
+		t.Fatalf("player count mismatch: got %v want %v", len(players), 2)
+	}
+	if players[1].Name != "Bob" || players[1].Score != 20 || players[1].Duration != 90500*time.Millisecond {
+		t.Fatalf("player mismatch: got %+v", players[1])
+	}
+}
+
+func TestRulesCompressed(t *testing.T) {
+	client := dial(t, newFakeServer(t))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	rules, err := client.Rules(ctx)
+	if err != nil {
+		t.Fatalf("Rules failed: %v", err)
+	}
+	if rules["mp_timelimit"] != "30" || rules["sv_gravity"] != "800" || len(rules) != 2 {
+		t.Fatalf("rules mismatch: got %v", rules)
+	}
+}
+
+func TestCompressedChecksumMismatch(t *testing.T) {
+	response := &splitResponse{parts: make([][]byte, 1)}
+	response.add(splitPart{total: 1, compressed: true, size: uint32(len(rulesBody)), checksum: 1, payload: rulesCompressed})
+	if _, err := response.assemble(); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+}
+
+func TestNoResponse(t *testing.T) {
+	con, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer con.Close()
+	client := dial(t, con.LocalAddr().String())
+	client.Timeout = 50 * time.Millisecond
+	if _, err := client.Info(context.Background()); !errors.Is(err, ErrNoResponse) {
+		t.Fatalf("expected ErrNoResponse, got %v", err)
+	}
+}
+
+func TestLateResponseIsDiscarded(t *testing.T) {
+	con, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer con.Close()
+	go func() {
+		buf := make([]byte, maxDatagram)
+		for {
+			n, addr, err := con.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			request := buf[:n]
+			switch {
+			case len(request) < 5:
+			case request[4] == requestInfo:
+				// answered after the client gave up
+				time.Sleep(150 * time.Millisecond)
+				con.WriteTo(infoBody(), addr)
+			case !bytes.HasSuffix(request, testChallenge):
+				con.WriteTo(append([]byte("\xff\xff\xff\xffA"), testChallenge...), addr)
+			default:
+				for _, part := range split(7, playersBody(), 2, nil) {
+					con.WriteTo(part, addr)
+				}
+			}
+		}
+	}()
+	client := dial(t, con.LocalAddr().String())
+	client.Timeout = 50 * time.Millisecond
+	if _, err := client.Info(context.Background()); !errors.Is(err, ErrNoResponse) {
+		t.Fatalf("expected ErrNoResponse, got %v", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	client.Timeout = 5 * time.Second
+	players, err := client.Players(context.Background())
+	if err != nil {
+		t.Fatalf("Players failed: %v", err)
+	}
+	if len(players) != 2 {
+		t.Fatalf("player count mismatch: got %v want %v", len(players), 2)
+	}
+}
+
+func TestParseTruncated(t *testing.T) {
+	body := infoBody()[5:]
+	if _, err := parseInfo(body[:10]); !errors.Is(err, ErrInvalidResponse) {
+		t.Fatalf("expected ErrInvalidResponse, got %v", err)
+	}
+}
@@ -2,9 +2,17 @@ package rcon
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/packet"
 )
 
 // MockConn implements net.Conn for testing
@@ -144,3 +152,302 @@ func TestRCONClientRead(t *testing.T) {
 		t.Fatalf("count should not increment on Read: got %d want 0", client.count)
 	}
 }
+
+// pipeServer reads packets from the server side of a net.Pipe and hands them to respond
+func pipeServer(t *testing.T, respond func(server net.Conn, pkt packet.RCONPacket)) *Client {
+	t.Helper()
+	clientSide, serverSide := net.Pipe()
+	go func() {
+		for {
+			pkt, err := packet.Read(serverSide)
+			if err != nil {
+				return
+			}
+			respond(serverSide, pkt)
+		}
+	}()
+	client := NewFromConn("pipe", clientSide)
+	t.Cleanup(func() {
+		client.Close()
+		serverSide.Close()
+	})
+	return client
+}
+
+func TestRCONClientExecute(t *testing.T) {
+	client := pipeServer(t, func(server net.Conn, pkt packet.RCONPacket) {
+		reply := packet.New(pkt.Id, packet.SERVERDATA_RESPONSE_VALUE, []byte("echo "+pkt.BodyStr()))
+		server.Write(reply.Serialize())
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	response, err := client.Execute(ctx, "status")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if response != "echo status" {
+		t.Fatalf("response mismatch: got %q want %q", response, "echo status")
+	}
+}
+
+func TestRCONClientExecuteConcurrent(t *testing.T) {
+	const total = 20
+	var mu sync.Mutex
+	var received []packet.RCONPacket
+	client := pipeServer(t, func(server net.Conn, pkt packet.RCONPacket) {
+		// hold requests and answer them in reverse order, with a broadcast in between
+		mu.Lock()
+		received = append(received, pkt)
+		if len(received) < total {
+			mu.Unlock()
+			return
+		}
+		batch := received
+		mu.Unlock()
+		server.Write(packet.New(-1, packet.SERVERDATA_RESPONSE_VALUE, []byte("broadcast")).Serialize())
+		for i := len(batch) - 1; i >= 0; i-- {
+			reply := packet.New(batch[i].Id, packet.SERVERDATA_RESPONSE_VALUE, batch[i].Body)
+			server.Write(reply.Serialize())
+		}
+	})
+	broadcasts := client.Broadcasts()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make(chan error, total)
+	for i := 0; i < total; i++ {
+		wg.Add(1)
+		go func(cmd string) {
+			defer wg.Done()
+			response, err := client.Execute(ctx, cmd)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if response != cmd {
+				errs <- fmt.Errorf("response mismatch: got %q want %q", response, cmd)
+			}
+		}(fmt.Sprintf("cmd %d", i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	select {
+	case pkt := <-broadcasts:
+		if pkt.BodyStr() != "broadcast" {
+			t.Fatalf("broadcast mismatch: got %q want %q", pkt.BodyStr(), "broadcast")
+		}
+	case <-ctx.Done():
+		t.Fatal("broadcast was not delivered")
+	}
+}
+
+func TestRCONClientExecuteContextCancel(t *testing.T) {
+	client := pipeServer(t, func(server net.Conn, pkt packet.RCONPacket) {})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.Execute(ctx, "never answered")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestRCONClientAuthenticateContextCancel(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	rconClient := NewFromConn("pipe", client)
+	defer rconClient.Close()
+	// the server never answers, only cancellation can end the exchange
+	go io.Copy(io.Discard, server)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	done := make(chan error, 1)
+	go func() {
+		_, err := rconClient.Authenticate(ctx, "secret")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Authenticate ignored the cancelled context")
+	}
+}
+
+func TestRCONClientExecuteStalledWrite(t *testing.T) {
+	// the peer never reads, so writes on the synchronous pipe block
+	server, client := net.Pipe()
+	defer server.Close()
+	rconClient := NewFromConn("pipe", client)
+	defer rconClient.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	errs := make(chan error, 2)
+	for range 2 {
+		go func() {
+			_, err := rconClient.Execute(ctx, "status")
+			errs <- err
+		}()
+	}
+	for range 2 {
+		select {
+		case err := <-errs:
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("expected DeadlineExceeded, got %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Execute blocked on a stalled write past its deadline")
+		}
+	}
+}
+
+func TestRCONClientExecuteAfterClose(t *testing.T) {
+	client := pipeServer(t, func(server net.Conn, pkt packet.RCONPacket) {})
+	client.Broadcasts()
+	client.Close()
+	<-client.Done()
+
+	_, err := client.Execute(context.Background(), "status")
+	if !errors.Is(err, ErrClientClosed) && !errors.Is(err, ErrWriteFailed) {
+		t.Fatalf("expected closed client error, got %v", err)
+	}
+}
+
+func TestRCONClientExecuteMultiSentinel(t *testing.T) {
+	fragments := []string{"first fragment,", "second fragment,", "third fragment"}
+	client := pipeServer(t, func(server net.Conn, pkt packet.RCONPacket) {
+		if pkt.Type == packet.SERVERDATA_RESPONSE_VALUE {
+			// mirror the sentinel the way Source servers do, trailing packet included
+			server.Write(packet.New(pkt.Id, packet.SERVERDATA_RESPONSE_VALUE, []byte{}).Serialize())
+			server.Write(packet.New(pkt.Id, packet.SERVERDATA_RESPONSE_VALUE, []byte{0, 1, 0, 0}).Serialize())
+			return
+		}
+		for _, fragment := range fragments {
+			server.Write(packet.New(pkt.Id, packet.SERVERDATA_RESPONSE_VALUE, []byte(fragment)).Serialize())
+		}
+	})
+	broadcasts := client.Broadcasts()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	response, err := client.ExecuteMulti(ctx, "cvarlist")
+	if err != nil {
+		t.Fatalf("ExecuteMulti failed: %v", err)
+	}
+	expected := strings.Join(fragments, "")
+	if response != expected {
+		t.Fatalf("response mismatch: got %q want %q", response, expected)
+	}
+
+	// the trailing packet must not leak out as a broadcast
+	_, err = client.Execute(ctx, "status")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	select {
+	case pkt := <-broadcasts:
+		t.Fatalf("unexpected broadcast: %v", pkt)
+	default:
+	}
+}
+
+func TestRCONClientExecuteMultiQuietPeriod(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	defer serverSide.Close()
+	client := NewFromConn("pipe", clientSide, WithMultiPacketStrategy(MultiPacketStrategy{
+		QuietPeriod: 50 * time.Millisecond,
+	}))
+	defer client.Close()
+	go func() {
+		pkt, err := packet.Read(serverSide)
+		if err != nil {
+			return
+		}
+		serverSide.Write(packet.New(pkt.Id, packet.SERVERDATA_RESPONSE_VALUE, []byte("part one ")).Serialize())
+		time.Sleep(10 * time.Millisecond)
+		serverSide.Write(packet.New(pkt.Id, packet.SERVERDATA_RESPONSE_VALUE, []byte("part two")).Serialize())
+		io.Copy(io.Discard, serverSide)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	response, err := client.ExecuteMulti(ctx, "banlist")
+	if err != nil {
+		t.Fatalf("ExecuteMulti failed: %v", err)
+	}
+	if response != "part one part two" {
+		t.Fatalf("response mismatch: got %q want %q", response, "part one part two")
+	}
+}
+
+func TestRCONClientOversizedPacketFailsConnection(t *testing.T) {
+	client := pipeServer(t, func(server net.Conn, pkt packet.RCONPacket) {
+		server.Write([]byte{0xFF, 0xFF, 0xFF, 0x7F})
+	})
+	client.maxPacketSize = 4096
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := client.Execute(ctx, "status")
+	var tooLarge *packet.ErrPacketTooLarge
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("expected ErrPacketTooLarge, got %v", err)
+	}
+}
+
+func TestRCONClientExecuteMultiCancelledBeforeSentinelEcho(t *testing.T) {
+	type mirror struct {
+		server net.Conn
+		id     int32
+	}
+	sentinels := make(chan mirror, 1)
+	client := pipeServer(t, func(server net.Conn, pkt packet.RCONPacket) {
+		if pkt.Type == packet.SERVERDATA_RESPONSE_VALUE {
+			sentinels <- mirror{server, pkt.Id}
+			return
+		}
+		if pkt.BodyStr() == "status" {
+			server.Write(packet.New(pkt.Id, packet.SERVERDATA_RESPONSE_VALUE, []byte("ok")).Serialize())
+		}
+	})
+	broadcasts := client.Broadcasts()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := client.ExecuteMulti(ctx, "cvarlist")
+		errs <- err
+	}()
+	var sentinel mirror
+	select {
+	case sentinel = <-sentinels:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sentinel was not sent")
+	}
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	// the server mirrors the sentinel only after the request gave up
+	sentinel.server.Write(packet.New(sentinel.id, packet.SERVERDATA_RESPONSE_VALUE, []byte{}).Serialize())
+	sentinel.server.Write(packet.New(sentinel.id, packet.SERVERDATA_RESPONSE_VALUE, []byte{0, 1, 0, 0}).Serialize())
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.Execute(ctx, "status"); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	select {
+	case pkt := <-broadcasts:
+		t.Fatalf("unexpected broadcast: %v", pkt)
+	default:
+	}
+}
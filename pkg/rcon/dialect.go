@@ -0,0 +1,177 @@
+package rcon
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/common_rcon"
+	"github.com/UltimateForm/tcprcon/pkg/packet"
+)
+
+// Dialect captures how a server family deviates from the Valve protocol,
+// see the README's "Server Protocol Compliance" section.
+type Dialect struct {
+	Name string
+	// Authenticate runs the login handshake on a fresh connection,
+	// nil means common_rcon.Authenticate
+	Authenticate func(client *Client, password string) (bool, error)
+	// Filter reports whether an incoming packet should be dispatched at all, nil keeps everything
+	Filter func(pkt packet.RCONPacket) bool
+	// DedupeWindow drops unsolicited packets whose body repeats a response
+	// delivered within the window, zero disables deduplication
+	DedupeWindow time.Duration
+	MultiPacket  MultiPacketStrategy
+	// KeepaliveCommand is a cheap command sent periodically to keep idle connections open,
+	// empty if the server doesn't need one
+	KeepaliveCommand string
+	// Classify tells apart the kinds of unsolicited packets, nil treats them all as EventBroadcast
+	Classify func(pkt packet.RCONPacket) EventKind
+	// FormatCodes is set when bodies carry Minecraft style § formatting codes
+	FormatCodes bool
+}
+
+func (src Dialect) classify(pkt packet.RCONPacket) EventKind {
+	if src.Classify == nil {
+		return EventBroadcast
+	}
+	return src.Classify(pkt)
+}
+
+var SourceDialect = Dialect{
+	Name:             "source",
+	MultiPacket:      DefaultMultiPacketStrategy,
+	KeepaliveCommand: "echo",
+}
+
+// RustDialect targets Rust's legacy TCP RCON, which echoes commands as ID 0 log packets of
+// type 4, repeats command output with ID 0 and uses ID -1 to mark the end of a response.
+var RustDialect = Dialect{
+	Name: "rust",
+	Filter: func(pkt packet.RCONPacket) bool {
+		return pkt.Type <= packet.SERVERDATA_AUTH && pkt.Id != -1
+	},
+	DedupeWindow: 2 * time.Second,
+	MultiPacket:  MultiPacketStrategy{QuietPeriod: 300 * time.Millisecond},
+}
+
+// MinecraftDialect targets vanilla Minecraft, which answers unknown packet types with
+// "Unknown request" instead of mirroring them and splits responses every 4096 bytes
+// without marking the last fragment. A shorter fragment ends the response, the quiet
+// period covers responses that are an exact multiple of 4096 bytes.
+var MinecraftDialect = Dialect{
+	Name:        "minecraft",
+	MultiPacket: MultiPacketStrategy{FragmentSize: 4096, QuietPeriod: 500 * time.Millisecond},
+	FormatCodes: true,
+}
+
+var SquadDialect = Dialect{
+	Name:             "squad",
+	MultiPacket:      MultiPacketStrategy{Sentinel: true},
+	KeepaliveCommand: "ShowServerInfo",
+}
+
+// MordhauDialect expects broadcasts to be opted into with listen commands; the server
+// answers the "alive" keepalive with "Keeping client alive".
+var MordhauDialect = Dialect{
+	Name:             "mordhau",
+	MultiPacket:      MultiPacketStrategy{QuietPeriod: 300 * time.Millisecond},
+	KeepaliveCommand: "alive",
+	Classify: func(pkt packet.RCONPacket) EventKind {
+		if strings.TrimSpace(pkt.BodyStr()) == "Keeping client alive" {
+			return EventKeepalive
+		}
+		return EventBroadcast
+	},
+}
+
+var (
+	dialectsMu sync.RWMutex
+	dialects   = map[string]Dialect{
+		SourceDialect.Name:    SourceDialect,
+		"valve":               SourceDialect,
+		RustDialect.Name:      RustDialect,
+		MinecraftDialect.Name: MinecraftDialect,
+		SquadDialect.Name:     SquadDialect,
+		MordhauDialect.Name:   MordhauDialect,
+	}
+)
+
+// RegisterDialect makes a custom dialect available to LookupDialect.
+func RegisterDialect(dialect Dialect) {
+	dialectsMu.Lock()
+	defer dialectsMu.Unlock()
+	dialects[strings.ToLower(dialect.Name)] = dialect
+}
+
+func LookupDialect(name string) (Dialect, error) {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	dialect, ok := dialects[strings.ToLower(name)]
+	if !ok {
+		return Dialect{}, fmt.Errorf("%w: %q", ErrUnknownDialect, name)
+	}
+	return dialect, nil
+}
+
+func DialectNames() []string {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	names := make([]string, 0, len(dialects))
+	for name := range dialects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (src Dialect) authenticate(client *Client, password string) (bool, error) {
+	if src.Authenticate != nil {
+		return src.Authenticate(client, password)
+	}
+	return common_rcon.Authenticate(client, password)
+}
+
+// deduper remembers recently delivered response bodies
+type deduper struct {
+	window time.Duration
+	mu     sync.Mutex
+	seen   map[string]time.Time
+}
+
+func (src *deduper) remember(body []byte) {
+	if src == nil || len(body) == 0 {
+		return
+	}
+	now := time.Now()
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	for seenBody, at := range src.seen {
+		if now.Sub(at) > src.window {
+			delete(src.seen, seenBody)
+		}
+	}
+	src.seen[string(body)] = now
+}
+
+func (src *deduper) duplicate(body []byte) bool {
+	if src == nil || len(body) == 0 {
+		return false
+	}
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	at, ok := src.seen[string(body)]
+	return ok && time.Since(at) <= src.window
+}
+
+func newDeduper(window time.Duration) *deduper {
+	if window <= 0 {
+		return nil
+	}
+	return &deduper{
+		window: window,
+		seen:   make(map[string]time.Time),
+	}
+}
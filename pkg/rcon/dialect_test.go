@@ -0,0 +1,137 @@
+package rcon
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/packet"
+)
+
+func TestLookupDialect(t *testing.T) {
+	for _, name := range []string{"source", "Valve", "rust", "minecraft", "squad", "MORDHAU"} {
+		if _, err := LookupDialect(name); err != nil {
+			t.Fatalf("LookupDialect(%q) failed: %v", name, err)
+		}
+	}
+	_, err := LookupDialect("quake")
+	if !errors.Is(err, ErrUnknownDialect) {
+		t.Fatalf("expected ErrUnknownDialect, got %v", err)
+	}
+}
+
+func TestRustDialectFiltersNoise(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	defer serverSide.Close()
+	client := NewFromConn("pipe", clientSide, WithDialect(RustDialect))
+	defer client.Close()
+	go func() {
+		pkt, err := packet.Read(serverSide)
+		if err != nil {
+			return
+		}
+		// log echo, real output, duplicated output, end of stream marker, then a real broadcast
+		serverSide.Write(packet.New(0, 4, []byte("[RCON][127.0.0.1:5000] "+pkt.BodyStr())).Serialize())
+		serverSide.Write(packet.New(pkt.Id, packet.SERVERDATA_RESPONSE_VALUE, []byte("hostname: test")).Serialize())
+		serverSide.Write(packet.New(0, packet.SERVERDATA_RESPONSE_VALUE, []byte("hostname: test")).Serialize())
+		serverSide.Write(packet.New(-1, packet.SERVERDATA_RESPONSE_VALUE, []byte{}).Serialize())
+		serverSide.Write(packet.New(0, packet.SERVERDATA_RESPONSE_VALUE, []byte("player joined")).Serialize())
+	}()
+	broadcasts := client.Broadcasts()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	response, err := client.Execute(ctx, "info")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if response != "hostname: test" {
+		t.Fatalf("response mismatch: got %q want %q", response, "hostname: test")
+	}
+	select {
+	case pkt := <-broadcasts:
+		if pkt.BodyStr() != "player joined" {
+			t.Fatalf("broadcast mismatch: got %q want %q", pkt.BodyStr(), "player joined")
+		}
+	case <-ctx.Done():
+		t.Fatal("broadcast was not delivered")
+	}
+}
+
+func TestClientAuthenticateWrongPassword(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	defer serverSide.Close()
+	client := NewFromConn("pipe", clientSide)
+	defer client.Close()
+	go func() {
+		pkt, err := packet.Read(serverSide)
+		if err != nil {
+			return
+		}
+		serverSide.Write(packet.New(pkt.Id, packet.SERVERDATA_RESPONSE_VALUE, []byte{}).Serialize())
+		serverSide.Write(packet.New(-1, packet.SERVERDATA_AUTH_RESPONSE, []byte{}).Serialize())
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ok, err := client.Authenticate(ctx, "wrong")
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if ok {
+		t.Fatal("Authenticate should report failure for ID -1")
+	}
+}
+
+func TestClientAuthenticateAfterStart(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	defer serverSide.Close()
+	client := NewFromConn("pipe", clientSide)
+	defer client.Close()
+	client.Broadcasts()
+
+	_, err := client.Authenticate(context.Background(), "password")
+	if !errors.Is(err, ErrReaderStarted) {
+		t.Fatalf("expected ErrReaderStarted, got %v", err)
+	}
+}
+
+func TestMinecraftDialectFragmentedResponse(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	defer serverSide.Close()
+	client := NewFromConn("pipe", clientSide, WithDialect(MinecraftDialect))
+	defer client.Close()
+	full := strings.Repeat("x", 4096)
+	go func() {
+		for {
+			pkt, err := packet.Read(serverSide)
+			if err != nil {
+				return
+			}
+			if pkt.Type != packet.SERVERDATA_EXECCOMMAND {
+				serverSide.Write(packet.New(pkt.Id, packet.SERVERDATA_RESPONSE_VALUE, []byte("Unknown request 0")).Serialize())
+				continue
+			}
+			serverSide.Write(packet.New(pkt.Id, packet.SERVERDATA_RESPONSE_VALUE, []byte(full)).Serialize())
+			serverSide.Write(packet.New(pkt.Id, packet.SERVERDATA_RESPONSE_VALUE, []byte("§6tail")).Serialize())
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	started := time.Now()
+	response, err := client.ExecuteMulti(ctx, "help")
+	if err != nil {
+		t.Fatalf("ExecuteMulti failed: %v", err)
+	}
+	if response != full+"§6tail" {
+		t.Fatalf("response mismatch: got %v bytes want %v", len(response), len(full)+len("§6tail"))
+	}
+	// the short fragment ends the response without waiting for the quiet period
+	if elapsed := time.Since(started); elapsed >= MinecraftDialect.MultiPacket.QuietPeriod {
+		t.Fatalf("response took %v, expected it to complete before the quiet period", elapsed)
+	}
+}
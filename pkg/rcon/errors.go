@@ -0,0 +1,10 @@
+package rcon
+
+import "errors"
+
+var ErrClientClosed error = errors.New("rcon client closed")
+var ErrWriteFailed error = errors.New("failed to write packet")
+var ErrUnknownDialect error = errors.New("unknown dialect")
+var ErrReaderStarted error = errors.New("connection already handed over to the background reader")
+var ErrAuthenticationFailed error = errors.New("authentication failed")
+var ErrSubscriberOverflow error = errors.New("subscriber could not keep up with events")
@@ -0,0 +1,52 @@
+package rcon
+
+import (
+	"context"
+	"net"
+)
+
+// Executor runs commands on a server. It is implemented by Client, ReconnectingClient,
+// pool.Pool and the battleye, udprcon, webrcon and telnetcon clients, so game logic
+// written against it works over any of them, or over a fake in tests.
+type Executor interface {
+	Execute(ctx context.Context, cmd string) (string, error)
+	// ExecuteMulti waits for responses split across several packets
+	ExecuteMulti(ctx context.Context, cmd string) (string, error)
+}
+
+// Subscriber delivers what the server sends on its own, such as chat or log lines.
+type Subscriber interface {
+	Subscribe(filter EventFilter, opts ...SubscribeOption) (<-chan Event, *Subscription)
+}
+
+// Authenticator logs a connection in, false means the password was rejected.
+type Authenticator interface {
+	Authenticate(ctx context.Context, password string) (bool, error)
+}
+
+// Dialer opens the connections clients run on, *net.Dialer satisfies it. Supply one to
+// route connections through a proxy or a test harness.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+var (
+	_ Executor      = (*Client)(nil)
+	_ Subscriber    = (*Client)(nil)
+	_ Authenticator = (*Client)(nil)
+	_ Executor      = (*ReconnectingClient)(nil)
+	_ Subscriber    = (*ReconnectingClient)(nil)
+	_ Dialer        = (*net.Dialer)(nil)
+)
+
+// DialContext connects to address with dialer, a nil dialer uses net.Dialer.
+func DialContext(ctx context.Context, dialer Dialer, address string, opts ...Option) (*Client, error) {
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	con, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromConn(address, con, opts...), nil
+}
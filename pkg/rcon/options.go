@@ -0,0 +1,45 @@
+package rcon
+
+import "time"
+
+type Option func(*Client)
+
+// MultiPacketStrategy decides when a response split across several packets is complete.
+type MultiPacketStrategy struct {
+	// Sentinel follows the command with an empty SERVERDATA_RESPONSE_VALUE packet,
+	// the response is complete once the server mirrors it back
+	Sentinel bool
+	// QuietPeriod completes the response when no fragment arrived for this long after
+	// the first one, zero disables it. Combined with Sentinel it acts as a fallback
+	QuietPeriod time.Duration
+	// FragmentSize is the body size at which the server splits responses, a shorter
+	// fragment completes the response. Zero disables it, it is ignored along with Sentinel
+	// since the sentinel's echo would arrive after the response was returned
+	FragmentSize int
+}
+
+var DefaultMultiPacketStrategy = MultiPacketStrategy{Sentinel: true}
+
+func WithMultiPacketStrategy(strategy MultiPacketStrategy) Option {
+	return func(c *Client) {
+		c.multiPacket = strategy
+	}
+}
+
+// WithDialect adapts the client to a server family. It also sets the dialect's
+// MultiPacketStrategy, so pass WithMultiPacketStrategy after it to override that.
+func WithDialect(dialect Dialect) Option {
+	return func(c *Client) {
+		c.dialect = dialect
+		c.multiPacket = dialect.MultiPacket
+		c.dedupe = newDeduper(dialect.DedupeWindow)
+	}
+}
+
+// WithMaxPacketSize caps the size prefix accepted from the server, a packet above it
+// ends the connection with a *packet.ErrPacketTooLarge.
+func WithMaxPacketSize(size uint32) Option {
+	return func(c *Client) {
+		c.maxPacketSize = size
+	}
+}
@@ -1,20 +1,62 @@
 package rcon
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/UltimateForm/tcprcon/pkg/logger"
+	"github.com/UltimateForm/tcprcon/pkg/packet"
 )
 
+const (
+	broadcastBuffer = 32
+	pendingBuffer   = 16
+	// how long to wait for the trailing packet Source servers send after a sentinel echo
+	sentinelTrailTTL = 5 * time.Second
+)
+
+// Client is a Source RCON connection.
+//
+// Before the first call to Execute or Broadcasts the client behaves like a plain
+// net.Conn wrapper (Read, Write, Id), which is what common_rcon.Authenticate relies on.
+// Once Execute or Broadcasts is called a single background reader takes over the
+// connection and dispatches incoming packets to pending requests by ID; from that
+// point on Read must not be used.
 type Client struct {
 	Address string
 	con     net.Conn
 	count   int32
+
+	writeMu   sync.Mutex
+	mu        sync.Mutex
+	pending   map[int32]*pendingRequest
+	discard   map[int32]time.Time
+	events    *EventHub
+	broadcast chan packet.RCONPacket
+	startOnce sync.Once
+	done      chan struct{}
+	err       error
+	closed    atomic.Bool
+	started   atomic.Bool
+
+	dialect       Dialect
+	dedupe        *deduper
+	multiPacket   MultiPacketStrategy
+	maxPacketSize uint32
+}
+
+type pendingRequest struct {
+	packets chan packet.RCONPacket
+	cancel  chan struct{}
 }
 
 func (src *Client) Id() int32 {
-	return src.count
+	return atomic.LoadInt32(&src.count)
 }
 
 func (src *Client) Read(p []byte) (int, error) {
@@ -23,8 +65,10 @@ func (src *Client) Read(p []byte) (int, error) {
 
 func (src *Client) Write(p []byte) (int, error) {
 	defer func() {
-		src.count++
+		atomic.AddInt32(&src.count, 1)
 	}()
+	src.writeMu.Lock()
+	defer src.writeMu.Unlock()
 	return src.con.Write(p)
 }
 
@@ -42,17 +86,392 @@ func (src *Client) SetWriteDeadline(t time.Time) error {
 
 func (src *Client) Close() error {
 	logger.Debug.Println("Closing connection to", src.Address)
+	src.closed.Store(true)
 	return src.con.Close()
 }
 
-func New(address string) (*Client, error) {
+// Authenticate logs in using the client's dialect. It must be called before
+// the background reader is started by Execute or Broadcasts.
+func (src *Client) Authenticate(ctx context.Context, password string) (bool, error) {
+	if src.started.Load() {
+		return false, ErrReaderStarted
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		src.con.SetDeadline(deadline)
+	}
+	// cancelling ctx interrupts the exchange by expiring the deadline
+	stop := context.AfterFunc(ctx, func() { src.con.SetDeadline(time.Now()) })
+	ok, err := src.dialect.authenticate(src, password)
+	if !stop() {
+		// the deadline may have expired after the exchange, the connection can't be used
+		return false, ctx.Err()
+	}
+	src.con.SetDeadline(time.Time{})
+	return ok, err
+}
+
+func (src *Client) Dialect() Dialect {
+	return src.dialect
+}
+
+// DefaultKeepaliveInterval is how often long-lived connections, such as the proxy's
+// upstream or the gateway's event streams, send the dialect's keepalive command.
+const DefaultKeepaliveInterval = 100 * time.Second
+
+// Keepalive sends the dialect's keepalive command every interval until ctx is done.
+// It returns right away if the dialect doesn't define one.
+func (src *Client) Keepalive(ctx context.Context, interval time.Duration) {
+	if src.dialect.KeepaliveCommand == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-src.Done():
+			return
+		case <-ticker.C:
+			execCtx, cancel := context.WithTimeout(ctx, interval)
+			_, err := src.Execute(execCtx, src.dialect.KeepaliveCommand)
+			cancel()
+			if err != nil {
+				logger.Warn.Printf("keepalive to %v failed: %v", src.Address, err)
+			}
+		}
+	}
+}
+
+// Execute sends cmd as a SERVERDATA_EXECCOMMAND and returns the body of the
+// response carrying the same ID. It is safe to call from many goroutines at once.
+func (src *Client) Execute(ctx context.Context, cmd string) (string, error) {
+	pkt, err := src.ExecutePacket(ctx, cmd)
+	if err != nil {
+		return "", err
+	}
+	return pkt.BodyStr(), nil
+}
+
+// ExecutePacket is Execute but returns the whole response packet.
+func (src *Client) ExecutePacket(ctx context.Context, cmd string) (packet.RCONPacket, error) {
+	src.start()
+	id := src.nextId()
+	req := src.register(id)
+	defer src.unregister(id)
+
+	err := src.send(ctx, packet.New(id, packet.SERVERDATA_EXECCOMMAND, []byte(cmd)))
+	if err != nil {
+		return packet.RCONPacket{}, errors.Join(ErrWriteFailed, err)
+	}
+	select {
+	case pkt := <-req.packets:
+		return pkt, nil
+	case <-ctx.Done():
+		return packet.RCONPacket{}, ctx.Err()
+	case <-src.done:
+		return packet.RCONPacket{}, src.err
+	}
+}
+
+// ExecuteMulti is Execute for commands whose output may span several packets
+// (long player lists, ban lists, cvarlist). Fragments sharing the command's ID are
+// concatenated until the client's MultiPacketStrategy considers the response complete.
+func (src *Client) ExecuteMulti(ctx context.Context, cmd string) (string, error) {
+	pkt, err := src.ExecuteMultiPacket(ctx, cmd)
+	if err != nil {
+		return "", err
+	}
+	return pkt.BodyStr(), nil
+}
+
+// ExecuteMultiPacket is ExecuteMulti but returns a packet carrying the command's ID
+// and the reassembled body.
+func (src *Client) ExecuteMultiPacket(ctx context.Context, cmd string) (packet.RCONPacket, error) {
+	src.start()
+	strategy := src.multiPacket
+	id := src.nextId()
+	ids := []int32{id}
+	var sentinelId int32
+	if strategy.Sentinel {
+		sentinelId = src.nextId()
+		ids = append(ids, sentinelId)
+	}
+	// both IDs share one pending request so fragments and the sentinel echo keep their order
+	req := src.register(ids...)
+	defer src.unregister(ids...)
+
+	err := src.send(ctx, packet.New(id, packet.SERVERDATA_EXECCOMMAND, []byte(cmd)))
+	if err == nil && strategy.Sentinel {
+		err = src.send(ctx, packet.New(sentinelId, packet.SERVERDATA_RESPONSE_VALUE, []byte{}))
+		if err == nil {
+			// runs before unregister, so the echo and its trailer are dropped even when
+			// the request gives up before they arrive
+			defer src.expectTrail(sentinelId)
+		}
+	}
+	if err != nil {
+		return packet.RCONPacket{}, errors.Join(ErrWriteFailed, err)
+	}
+
+	var body bytes.Buffer
+	var quiet *time.Timer
+	var quietC <-chan time.Time
+	if strategy.QuietPeriod > 0 {
+		quiet = time.NewTimer(strategy.QuietPeriod)
+		quiet.Stop()
+		defer quiet.Stop()
+	}
+	for {
+		select {
+		case pkt := <-req.packets:
+			if strategy.Sentinel && pkt.Id == sentinelId {
+				return packet.New(id, packet.SERVERDATA_RESPONSE_VALUE, body.Bytes()), nil
+			}
+			body.Write(pkt.Body)
+			if !strategy.Sentinel && strategy.FragmentSize > 0 && len(pkt.Body) < strategy.FragmentSize {
+				return packet.New(id, packet.SERVERDATA_RESPONSE_VALUE, body.Bytes()), nil
+			}
+			if quiet != nil {
+				quiet.Reset(strategy.QuietPeriod)
+				quietC = quiet.C
+			}
+		case <-quietC:
+			logger.Debug.Printf("response to %v completed by quiet period", id)
+			return packet.New(id, packet.SERVERDATA_RESPONSE_VALUE, body.Bytes()), nil
+		case <-ctx.Done():
+			return packet.RCONPacket{}, ctx.Err()
+		case <-src.done:
+			return packet.RCONPacket{}, src.err
+		}
+	}
+}
+
+// Broadcasts returns the channel receiving every packet whose ID does not belong to a
+// pending request, e.g. server events. The channel is closed when the connection ends.
+// Packets are dropped if the channel is not drained, use Subscribe for more control.
+func (src *Client) Broadcasts() <-chan packet.RCONPacket {
+	src.start()
+	return src.broadcast
+}
+
+// Subscribe returns a channel of the events accepted by filter, closed when the subscription
+// is cancelled or the connection ends. Buffer size and overflow policy default to
+// 32 events and OverflowDropNewest.
+func (src *Client) Subscribe(filter EventFilter, opts ...SubscribeOption) (<-chan Event, *Subscription) {
+	src.start()
+	return src.events.Subscribe(filter, opts...)
+}
+
+// Done is closed once the background reader stops, after which Err reports why.
+func (src *Client) Done() <-chan struct{} {
+	return src.done
+}
+
+func (src *Client) Err() error {
+	select {
+	case <-src.done:
+		return src.err
+	default:
+		return nil
+	}
+}
+
+func (src *Client) start() {
+	src.startOnce.Do(func() {
+		src.started.Store(true)
+		if src.pending == nil {
+			src.pending = make(map[int32]*pendingRequest)
+		}
+		if src.discard == nil {
+			src.discard = make(map[int32]time.Time)
+		}
+		if src.events == nil {
+			src.events = &EventHub{}
+		}
+		if src.broadcast == nil {
+			src.broadcast = make(chan packet.RCONPacket, broadcastBuffer)
+		}
+		if src.done == nil {
+			src.done = make(chan struct{})
+		}
+		// subscribed before reading so that no broadcast is missed
+		events, _ := src.events.Subscribe(nil, WithBuffer(broadcastBuffer), WithOverflow(OverflowDropNewest))
+		go forwardPackets(events, src.broadcast)
+		go src.readLoop()
+	})
+}
+
+func (src *Client) readLoop() {
+	decoder := packet.NewDecoder(src.con)
+	if src.maxPacketSize > 0 {
+		decoder.MaxPacketSize = src.maxPacketSize
+	}
+	for {
+		pkt, err := decoder.Decode()
+		if err != nil {
+			if src.closed.Load() {
+				err = ErrClientClosed
+			}
+			logger.Debug.Printf("reader for %v stopped: %v", src.Address, err)
+			src.err = err
+			close(src.done)
+			src.events.Close(err)
+			return
+		}
+		src.dispatch(pkt)
+	}
+}
+
+func (src *Client) dispatch(pkt packet.RCONPacket) {
+	if src.dialect.Filter != nil && !src.dialect.Filter(pkt) {
+		logger.Debug.Printf("%v dialect filtered packet %v of type %v", src.dialect.Name, pkt.Id, pkt.Type)
+		return
+	}
+	src.mu.Lock()
+	req, ok := src.pending[pkt.Id]
+	expiry, trailing := src.discard[pkt.Id]
+	trailing = trailing && time.Now().Before(expiry)
+	src.mu.Unlock()
+	if trailing && !ok {
+		logger.Debug.Printf("dropping trailing sentinel packet %v", pkt.Id)
+		return
+	}
+	if !ok {
+		if src.dedupe.duplicate(pkt.Body) {
+			logger.Debug.Printf("dropping duplicated packet %v", pkt.Id)
+			return
+		}
+		src.events.Publish(Event{Time: time.Now(), Packet: pkt, Kind: src.dialect.classify(pkt)})
+		return
+	}
+	src.dedupe.remember(pkt.Body)
+	select {
+	case req.packets <- pkt:
+	case <-req.cancel:
+	}
+}
+
+func (src *Client) register(ids ...int32) *pendingRequest {
+	req := &pendingRequest{
+		packets: make(chan packet.RCONPacket, pendingBuffer),
+		cancel:  make(chan struct{}),
+	}
+	src.mu.Lock()
+	for _, id := range ids {
+		src.pending[id] = req
+	}
+	src.mu.Unlock()
+	return req
+}
+
+func (src *Client) unregister(ids ...int32) {
+	var req *pendingRequest
+	src.mu.Lock()
+	for _, id := range ids {
+		if found, ok := src.pending[id]; ok {
+			req = found
+			delete(src.pending, id)
+		}
+	}
+	src.mu.Unlock()
+	if req != nil {
+		close(req.cancel)
+	}
+}
+
+// expectTrail drops what still arrives under a sentinel's ID, the packet Source servers
+// send right after mirroring it or, once the request gave up, the mirrored sentinel too,
+// so they aren't mistaken for broadcasts.
+func (src *Client) expectTrail(id int32) {
+	now := time.Now()
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	for trailId, expiry := range src.discard {
+		if now.After(expiry) {
+			delete(src.discard, trailId)
+		}
+	}
+	src.discard[id] = now.Add(sentinelTrailTTL)
+}
+
+// nextId hands out request IDs, skipping 0 and negative values which
+// servers use for unsolicited packets and auth failures.
+func (src *Client) nextId() int32 {
+	for {
+		current := atomic.LoadInt32(&src.count)
+		id := current
+		if id <= 0 {
+			id = 1
+		}
+		next := id + 1
+		if next <= 0 {
+			next = 1
+		}
+		if atomic.CompareAndSwapInt32(&src.count, current, next) {
+			return id
+		}
+	}
+}
+
+// send writes pkt within ctx. Whoever holds the lock is bounded by their own ctx in the
+// same way, so waiting for it is too
+func (src *Client) send(ctx context.Context, pkt packet.RCONPacket) error {
+	src.writeMu.Lock()
+	defer src.writeMu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// ctx's own deadline isn't copied to the connection, it could expire before ctx is
+	// done and surface as an i/o timeout instead of ctx's error
+	interrupted := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		src.con.SetWriteDeadline(time.Now())
+		close(interrupted)
+	})
+	data := pkt.Serialize()
+	n, err := src.con.Write(data)
+	if !stop() {
+		<-interrupted
+	}
+	src.con.SetWriteDeadline(time.Time{})
+	if err == nil {
+		return nil
+	}
+	if n > 0 && n < len(data) {
+		// the rest of the packet can't follow later, the stream would be out of sync
+		logger.Warn.Printf("partial write to %v, closing connection: %v", src.Address, err)
+		src.con.Close()
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// NewFromConn builds a client on top of an already established connection.
+func NewFromConn(address string, con net.Conn, opts ...Option) *Client {
+	client := &Client{
+		Address:   address,
+		con:       con,
+		count:     0,
+		pending:   make(map[int32]*pendingRequest),
+		discard:   make(map[int32]time.Time),
+		events:    &EventHub{},
+		broadcast: make(chan packet.RCONPacket, broadcastBuffer),
+		done:      make(chan struct{}),
+	}
+	WithDialect(SourceDialect)(client)
+	for _, opt := range opts {
+		opt(client)
+	}
+	return client
+}
+
+func New(address string, opts ...Option) (*Client, error) {
 	con, err := net.Dial("tcp", address)
 	if err != nil {
 		return nil, err
 	}
-	return &Client{
-		Address: address,
-		con:     con,
-		count:   0,
-	}, nil
+	return NewFromConn(address, con, opts...), nil
 }
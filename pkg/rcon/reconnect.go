@@ -0,0 +1,426 @@
+package rcon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/logger"
+	"github.com/UltimateForm/tcprcon/pkg/packet"
+)
+
+const stateBuffer = 16
+
+// ReconnectPolicy controls how a ReconnectingClient redials after losing its connection.
+// Delays grow from InitialBackoff by Multiplier up to MaxBackoff, each randomized by ±Jitter.
+type ReconnectPolicy struct {
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter is the fraction of each delay that is randomized, 0.2 means ±20%
+	Jitter float64
+	// MaxAttempts gives up after that many failed attempts in a row, zero retries forever
+	MaxAttempts int
+	// MaxElapsed gives up once the connection has been down for that long, zero retries forever
+	MaxElapsed  time.Duration
+	DialTimeout time.Duration
+	// Dialer opens each connection, nil uses net.Dialer
+	Dialer Dialer
+	// KeepaliveInterval sends the dialect's keepalive command this often, a failed keepalive
+	// is treated as a broken connection. Zero disables keepalives
+	KeepaliveInterval time.Duration
+}
+
+var DefaultReconnectPolicy = ReconnectPolicy{
+	InitialBackoff:    500 * time.Millisecond,
+	MaxBackoff:        30 * time.Second,
+	Multiplier:        2,
+	Jitter:            0.2,
+	DialTimeout:       10 * time.Second,
+	KeepaliveInterval: 60 * time.Second,
+}
+
+func (src ReconnectPolicy) backoff(attempt int) time.Duration {
+	delay := float64(src.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		delay *= max(src.Multiplier, 1)
+		if src.MaxBackoff > 0 && delay >= float64(src.MaxBackoff) {
+			delay = float64(src.MaxBackoff)
+			break
+		}
+	}
+	if src.Jitter > 0 {
+		delay += delay * src.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
+
+type ConnectionState int
+
+const (
+	StateConnecting ConnectionState = iota
+	StateConnected
+	StateDisconnected
+	StateClosed
+	StateFailed
+)
+
+func (src ConnectionState) String() string {
+	switch src {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateDisconnected:
+		return "disconnected"
+	case StateClosed:
+		return "closed"
+	case StateFailed:
+		return "failed"
+	}
+	return fmt.Sprintf("ConnectionState(%d)", int(src))
+}
+
+type StateChange struct {
+	State ConnectionState
+	// Attempt is the number of the connection attempt for StateConnecting
+	Attempt int
+	// Err is why the connection was lost or given up on
+	Err  error
+	Time time.Time
+}
+
+// ReconnectingClient keeps an authenticated Client alive, redialing with exponential backoff
+// whenever the connection breaks and replaying subscription commands afterwards.
+//
+// Commands are never retried on a new connection since they may not be idempotent,
+// a command interrupted by a disconnect returns the connection's error.
+type ReconnectingClient struct {
+	Address  string
+	password string
+	policy   ReconnectPolicy
+	opts     []Option
+
+	mu            sync.Mutex
+	client        *Client
+	ready         chan struct{}
+	subscriptions []string
+	state         ConnectionState
+
+	events    *EventHub
+	broadcast chan packet.RCONPacket
+	states    chan StateChange
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+	err       error
+}
+
+// NewReconnecting connects and authenticates to address, retrying per policy until ctx ends,
+// then keeps the connection up in the background until Close.
+func NewReconnecting(ctx context.Context, address, password string, policy ReconnectPolicy, opts ...Option) (*ReconnectingClient, error) {
+	supervisorCtx, cancel := context.WithCancel(context.Background())
+	src := &ReconnectingClient{
+		Address:   address,
+		password:  password,
+		policy:    policy,
+		opts:      opts,
+		ready:     make(chan struct{}),
+		events:    &EventHub{},
+		broadcast: make(chan packet.RCONPacket, broadcastBuffer),
+		states:    make(chan StateChange, stateBuffer),
+		ctx:       supervisorCtx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	events, _ := src.events.Subscribe(nil, WithBuffer(broadcastBuffer), WithOverflow(OverflowDropNewest))
+	go forwardPackets(events, src.broadcast)
+	stop := context.AfterFunc(ctx, cancel)
+	client, relayed, err := src.reconnect()
+	stop()
+	if err != nil {
+		cancel()
+		src.events.Close(err)
+		return nil, err
+	}
+	go src.supervise(client, relayed)
+	return src, nil
+}
+
+func (src *ReconnectingClient) Execute(ctx context.Context, cmd string) (string, error) {
+	client, err := src.current(ctx)
+	if err != nil {
+		return "", err
+	}
+	return client.Execute(ctx, cmd)
+}
+
+func (src *ReconnectingClient) ExecutePacket(ctx context.Context, cmd string) (packet.RCONPacket, error) {
+	client, err := src.current(ctx)
+	if err != nil {
+		return packet.RCONPacket{}, err
+	}
+	return client.ExecutePacket(ctx, cmd)
+}
+
+func (src *ReconnectingClient) ExecuteMulti(ctx context.Context, cmd string) (string, error) {
+	client, err := src.current(ctx)
+	if err != nil {
+		return "", err
+	}
+	return client.ExecuteMulti(ctx, cmd)
+}
+
+func (src *ReconnectingClient) ExecuteMultiPacket(ctx context.Context, cmd string) (packet.RCONPacket, error) {
+	client, err := src.current(ctx)
+	if err != nil {
+		return packet.RCONPacket{}, err
+	}
+	return client.ExecuteMultiPacket(ctx, cmd)
+}
+
+// AddSubscription runs cmd now and again after every reconnect, e.g. Mordhau's "listen chat".
+// A command that fails now isn't replayed.
+func (src *ReconnectingClient) AddSubscription(ctx context.Context, cmd string) error {
+	// added first so that a reconnect while cmd runs replays it too
+	src.mu.Lock()
+	src.subscriptions = append(src.subscriptions, cmd)
+	src.mu.Unlock()
+	_, err := src.Execute(ctx, cmd)
+	if err != nil {
+		src.mu.Lock()
+		if i := slices.Index(src.subscriptions, cmd); i >= 0 {
+			src.subscriptions = slices.Delete(src.subscriptions, i, i+1)
+		}
+		src.mu.Unlock()
+	}
+	return err
+}
+
+// Broadcasts returns a channel receiving broadcasts from every connection in turn,
+// it is closed once the client is closed or gives up.
+func (src *ReconnectingClient) Broadcasts() <-chan packet.RCONPacket {
+	return src.broadcast
+}
+
+// Subscribe works like Client.Subscribe, except that subscriptions carry over reconnects
+// and only end when the client is closed or gives up.
+func (src *ReconnectingClient) Subscribe(filter EventFilter, opts ...SubscribeOption) (<-chan Event, *Subscription) {
+	return src.events.Subscribe(filter, opts...)
+}
+
+// States returns a channel of connection state changes. Changes are dropped
+// if the channel is not drained, State always reports the latest one.
+func (src *ReconnectingClient) States() <-chan StateChange {
+	return src.states
+}
+
+func (src *ReconnectingClient) State() ConnectionState {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	return src.state
+}
+
+// Done is closed once the client is closed or gave up reconnecting, after which Err reports why.
+func (src *ReconnectingClient) Done() <-chan struct{} {
+	return src.done
+}
+
+func (src *ReconnectingClient) Err() error {
+	select {
+	case <-src.done:
+		return src.err
+	default:
+		return nil
+	}
+}
+
+func (src *ReconnectingClient) Close() error {
+	src.cancel()
+	src.mu.Lock()
+	client := src.client
+	src.mu.Unlock()
+	if client != nil {
+		return client.Close()
+	}
+	return nil
+}
+
+// current waits for a live connection
+func (src *ReconnectingClient) current(ctx context.Context) (*Client, error) {
+	for {
+		src.mu.Lock()
+		client, ready := src.client, src.ready
+		src.mu.Unlock()
+		if client != nil && client.Err() == nil {
+			return client, nil
+		}
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-src.done:
+			return nil, src.err
+		}
+	}
+}
+
+// supervise replaces each connection once it's lost and its events have been relayed
+func (src *ReconnectingClient) supervise(client *Client, relayed <-chan struct{}) {
+	for {
+		keepaliveCtx, stopKeepalive := context.WithCancel(src.ctx)
+		go src.keepalive(keepaliveCtx, client)
+		<-relayed
+		stopKeepalive()
+
+		src.mu.Lock()
+		src.client = nil
+		src.ready = make(chan struct{})
+		src.mu.Unlock()
+		if src.ctx.Err() != nil {
+			src.finish(StateClosed, ErrClientClosed)
+			return
+		}
+		logger.Warn.Printf("connection to %v lost: %v", src.Address, client.Err())
+		src.setState(StateChange{State: StateDisconnected, Err: client.Err()})
+
+		var err error
+		client, relayed, err = src.reconnect()
+		if err != nil {
+			if src.ctx.Err() != nil {
+				src.finish(StateClosed, ErrClientClosed)
+			} else {
+				src.finish(StateFailed, err)
+			}
+			return
+		}
+	}
+}
+
+// reconnect dials until a connection is authenticated and subscribed or the policy gives up,
+// returning it with a channel closed once all of its events were relayed
+func (src *ReconnectingClient) reconnect() (*Client, <-chan struct{}, error) {
+	started := time.Now()
+	for attempt := 1; ; attempt++ {
+		src.setState(StateChange{State: StateConnecting, Attempt: attempt})
+		client, relayed, err := src.connect()
+		if err == nil {
+			src.mu.Lock()
+			src.client = client
+			close(src.ready)
+			src.mu.Unlock()
+			src.setState(StateChange{State: StateConnected, Attempt: attempt})
+			return client, relayed, nil
+		}
+		if errors.Is(err, ErrAuthenticationFailed) {
+			return nil, nil, err
+		}
+		logger.Warn.Printf("connection attempt %v to %v failed: %v", attempt, src.Address, err)
+		if src.policy.MaxAttempts > 0 && attempt >= src.policy.MaxAttempts {
+			return nil, nil, fmt.Errorf("giving up after %v attempts: %w", attempt, err)
+		}
+		delay := src.policy.backoff(attempt)
+		if src.policy.MaxElapsed > 0 && time.Since(started)+delay > src.policy.MaxElapsed {
+			return nil, nil, fmt.Errorf("giving up after %v: %w", time.Since(started).Round(time.Millisecond), err)
+		}
+		select {
+		case <-src.ctx.Done():
+			return nil, nil, src.ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// connect dials and authenticates, then starts relaying events before replaying the
+// subscriptions so that no broadcast sent in response is missed, and so that the reader
+// isn't blocked on a full relay while a replayed command waits for it
+func (src *ReconnectingClient) connect() (*Client, <-chan struct{}, error) {
+	ctx := src.ctx
+	if src.policy.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, src.policy.DialTimeout)
+		defer cancel()
+	}
+	client, err := DialContext(ctx, src.policy.Dialer, src.Address, src.opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	ok, err := client.Authenticate(ctx, src.password)
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+	if !ok {
+		client.Close()
+		return nil, nil, ErrAuthenticationFailed
+	}
+	// subscribers apply their own overflow policies, the relay only hands events over
+	relay, _ := client.Subscribe(nil, WithBuffer(broadcastBuffer), WithOverflow(OverflowBlock))
+	relayed := make(chan struct{})
+	go func() {
+		defer close(relayed)
+		for event := range relay {
+			src.events.Publish(event)
+		}
+	}()
+	src.mu.Lock()
+	subscriptions := append([]string{}, src.subscriptions...)
+	src.mu.Unlock()
+	for _, cmd := range subscriptions {
+		if _, err := client.Execute(ctx, cmd); err != nil {
+			client.Close()
+			return nil, nil, fmt.Errorf("replaying subscription %q: %w", cmd, err)
+		}
+	}
+	return client, relayed, nil
+}
+
+// keepalive closes the client when a keepalive fails so that half-open connections get replaced
+func (src *ReconnectingClient) keepalive(ctx context.Context, client *Client) {
+	command := client.Dialect().KeepaliveCommand
+	interval := src.policy.KeepaliveInterval
+	if command == "" || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			execCtx, cancel := context.WithTimeout(ctx, interval)
+			_, err := client.Execute(execCtx, command)
+			cancel()
+			if err != nil && ctx.Err() == nil {
+				logger.Warn.Printf("keepalive to %v failed, dropping connection: %v", src.Address, err)
+				client.Close()
+				return
+			}
+		}
+	}
+}
+
+func (src *ReconnectingClient) setState(change StateChange) {
+	change.Time = time.Now()
+	src.mu.Lock()
+	src.state = change.State
+	src.mu.Unlock()
+	select {
+	case src.states <- change:
+	default:
+		logger.Debug.Printf("state channel full, dropping %v", change.State)
+	}
+}
+
+func (src *ReconnectingClient) finish(state ConnectionState, err error) {
+	src.setState(StateChange{State: state, Err: err})
+	src.err = err
+	close(src.done)
+	src.events.Close(err)
+	src.cancel()
+}
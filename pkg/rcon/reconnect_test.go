@@ -0,0 +1,290 @@
+package rcon_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/rcon"
+	"github.com/UltimateForm/tcprcon/pkg/rcontest"
+)
+
+var testPolicy = rcon.ReconnectPolicy{
+	InitialBackoff: 10 * time.Millisecond,
+	MaxBackoff:     50 * time.Millisecond,
+	Multiplier:     2,
+	Jitter:         0.2,
+	DialTimeout:    time.Second,
+}
+
+func waitForState(t *testing.T, states <-chan rcon.StateChange, want rcon.ConnectionState) rcon.StateChange {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case change := <-states:
+			if change.State == want {
+				return change
+			}
+		case <-timeout:
+			t.Fatalf("state %v not reached", want)
+		}
+	}
+}
+
+func TestReconnectingClientReplaysSubscriptions(t *testing.T) {
+	srv := rcontest.NewServer("secret")
+	defer srv.Close()
+	srv.Respond("listen chat", "listening")
+	srv.Respond("status", "ok")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := rcon.NewReconnecting(ctx, srv.Addr, "secret", testPolicy)
+	if err != nil {
+		t.Fatalf("NewReconnecting failed: %v", err)
+	}
+	defer client.Close()
+	states := client.States()
+	if err := client.AddSubscription(ctx, "listen chat"); err != nil {
+		t.Fatalf("AddSubscription failed: %v", err)
+	}
+
+	srv.CloseClientConnections()
+	waitForState(t, states, rcon.StateDisconnected)
+	waitForState(t, states, rcon.StateConnected)
+
+	response, err := client.Execute(ctx, "status")
+	if err != nil {
+		t.Fatalf("Execute after reconnect failed: %v", err)
+	}
+	if response != "ok" {
+		t.Fatalf("response mismatch: got %q want %q", response, "ok")
+	}
+	count := 0
+	for _, cmd := range srv.Commands() {
+		if cmd == "listen chat" {
+			count++
+		}
+	}
+	if count != 2 {
+		t.Fatalf("subscription count mismatch: got %v want %v", count, 2)
+	}
+}
+
+func TestReconnectingClientRelaysBroadcastsDuringReplay(t *testing.T) {
+	srv := rcontest.NewServer("secret")
+	defer srv.Close()
+	// the server greets a new listener before it answers the listen command
+	srv.Handle("listen chat", func(string) []string {
+		srv.Broadcast("Chat: welcome")
+		return []string{"listening"}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := rcon.NewReconnecting(ctx, srv.Addr, "secret", testPolicy)
+	if err != nil {
+		t.Fatalf("NewReconnecting failed: %v", err)
+	}
+	defer client.Close()
+	events, _ := client.Subscribe(rcon.KindFilter(rcon.EventBroadcast))
+	states := client.States()
+	if err := client.AddSubscription(ctx, "listen chat"); err != nil {
+		t.Fatalf("AddSubscription failed: %v", err)
+	}
+	srv.CloseClientConnections()
+	waitForState(t, states, rcon.StateConnected)
+
+	for i := range 2 {
+		select {
+		case event := <-events:
+			if event.Packet.BodyStr() != "Chat: welcome" {
+				t.Fatalf("event mismatch: got %q want %q", event.Packet.BodyStr(), "Chat: welcome")
+			}
+		case <-ctx.Done():
+			t.Fatalf("greeting %v was not relayed", i+1)
+		}
+	}
+}
+
+func TestReconnectingClientRelaysBurstDuringReplay(t *testing.T) {
+	srv := rcontest.NewServer("secret")
+	defer srv.Close()
+	// more broadcasts than the relay buffers arrive ahead of the listen command's response
+	srv.Handle("listen chat", func(string) []string {
+		for range 100 {
+			srv.Broadcast("Chat: backlog")
+		}
+		return []string{"listening"}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := rcon.NewReconnecting(ctx, srv.Addr, "secret", testPolicy)
+	if err != nil {
+		t.Fatalf("NewReconnecting failed: %v", err)
+	}
+	defer client.Close()
+	events, _ := client.Subscribe(rcon.KindFilter(rcon.EventBroadcast), rcon.WithBuffer(256))
+	states := client.States()
+	if err := client.AddSubscription(ctx, "listen chat"); err != nil {
+		t.Fatalf("AddSubscription failed: %v", err)
+	}
+	srv.CloseClientConnections()
+	waitForState(t, states, rcon.StateDisconnected)
+	change := waitForState(t, states, rcon.StateConnected)
+	if change.Attempt != 1 {
+		t.Fatalf("attempt mismatch: got %v want %v", change.Attempt, 1)
+	}
+	for i := range 200 {
+		select {
+		case <-events:
+		case <-ctx.Done():
+			t.Fatalf("only %v of %v broadcasts were relayed", i, 200)
+		}
+	}
+}
+
+func TestReconnectingClientDropsFailedSubscription(t *testing.T) {
+	srv := rcontest.NewServer("secret")
+	defer srv.Close()
+	srv.Respond("status", "ok")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := rcon.NewReconnecting(ctx, srv.Addr, "secret", testPolicy)
+	if err != nil {
+		t.Fatalf("NewReconnecting failed: %v", err)
+	}
+	defer client.Close()
+	states := client.States()
+	failing, cancelFailing := context.WithCancel(ctx)
+	cancelFailing()
+	if err := client.AddSubscription(failing, "listen chat"); err == nil {
+		t.Fatal("expected AddSubscription to fail with a cancelled context")
+	}
+
+	srv.CloseClientConnections()
+	waitForState(t, states, rcon.StateDisconnected)
+	waitForState(t, states, rcon.StateConnected)
+	if _, err := client.Execute(ctx, "status"); err != nil {
+		t.Fatalf("Execute after reconnect failed: %v", err)
+	}
+	for _, cmd := range srv.Commands() {
+		if cmd == "listen chat" {
+			t.Fatal("failed subscription was replayed after the reconnect")
+		}
+	}
+}
+
+func TestReconnectingClientForwardsBroadcastsAcrossReconnects(t *testing.T) {
+	srv := rcontest.NewServer("secret")
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := rcon.NewReconnecting(ctx, srv.Addr, "secret", testPolicy)
+	if err != nil {
+		t.Fatalf("NewReconnecting failed: %v", err)
+	}
+	defer client.Close()
+	states := client.States()
+
+	for _, body := range []string{"before", "after"} {
+		if body == "after" {
+			srv.CloseClientConnections()
+			waitForState(t, states, rcon.StateDisconnected)
+			waitForState(t, states, rcon.StateConnected)
+		}
+		// the server may only see the new session once authentication completes
+		for srv.Broadcast(body) == 0 {
+			time.Sleep(5 * time.Millisecond)
+		}
+		select {
+		case pkt := <-client.Broadcasts():
+			if pkt.BodyStr() != body {
+				t.Fatalf("broadcast mismatch: got %q want %q", pkt.BodyStr(), body)
+			}
+		case <-ctx.Done():
+			t.Fatalf("broadcast %q was not delivered", body)
+		}
+	}
+}
+
+func TestReconnectingClientGivesUp(t *testing.T) {
+	srv := rcontest.NewServer("secret")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	policy := testPolicy
+	policy.MaxAttempts = 3
+	client, err := rcon.NewReconnecting(ctx, srv.Addr, "secret", policy)
+	if err != nil {
+		t.Fatalf("NewReconnecting failed: %v", err)
+	}
+	defer client.Close()
+	states := client.States()
+
+	srv.Close()
+	change := waitForState(t, states, rcon.StateFailed)
+	if change.Err == nil {
+		t.Fatal("expected a failure reason")
+	}
+	select {
+	case <-client.Done():
+	case <-ctx.Done():
+		t.Fatal("client did not finish after giving up")
+	}
+	if _, err := client.Execute(ctx, "status"); err == nil {
+		t.Fatal("expected Execute to fail after giving up")
+	}
+	if _, ok := <-client.Broadcasts(); ok {
+		t.Fatal("expected broadcast channel to be closed")
+	}
+}
+
+func TestReconnectingClientWrongPassword(t *testing.T) {
+	srv := rcontest.NewServer("secret")
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := rcon.NewReconnecting(ctx, srv.Addr, "wrong", testPolicy)
+	if !errors.Is(err, rcon.ErrAuthenticationFailed) {
+		t.Fatalf("expected ErrAuthenticationFailed, got %v", err)
+	}
+}
+
+func TestReconnectingClientInitialDialHonoursContext(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = rcon.NewReconnecting(ctx, address, "secret", testPolicy)
+	if err == nil {
+		t.Fatal("expected dialing a closed port to fail")
+	}
+}
+
+func TestReconnectingClientClose(t *testing.T) {
+	srv := rcontest.NewServer("secret")
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := rcon.NewReconnecting(ctx, srv.Addr, "secret", testPolicy)
+	if err != nil {
+		t.Fatalf("NewReconnecting failed: %v", err)
+	}
+	states := client.States()
+	client.Close()
+	waitForState(t, states, rcon.StateClosed)
+	if !errors.Is(client.Err(), rcon.ErrClientClosed) {
+		t.Fatalf("expected ErrClientClosed, got %v", client.Err())
+	}
+}
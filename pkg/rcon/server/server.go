@@ -0,0 +1,348 @@
+// Package server implements the server side of the Source RCON protocol, modelled after net/http.
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/logger"
+	"github.com/UltimateForm/tcprcon/pkg/packet"
+)
+
+// MaxBodySize is the largest body sent in a single packet, longer responses
+// are split across several packets sharing the request ID.
+const MaxBodySize = 4096
+
+var ErrServerClosed error = errors.New("rcon: server closed")
+
+type Request struct {
+	Id         int32
+	Command    string
+	RemoteAddr string
+	ctx        context.Context
+}
+
+// Context is the per-connection context, cancelled when the connection ends.
+func (src *Request) Context() context.Context {
+	return src.ctx
+}
+
+// ResponseWriter buffers the response body, it is sent once ServeRCON returns.
+type ResponseWriter interface {
+	Write(p []byte) (int, error)
+	WriteString(s string) (int, error)
+}
+
+type Handler interface {
+	ServeRCON(ResponseWriter, *Request)
+}
+
+type HandlerFunc func(ResponseWriter, *Request)
+
+func (src HandlerFunc) ServeRCON(w ResponseWriter, r *Request) {
+	src(w, r)
+}
+
+// AuthFunc decides whether password grants access to the connection described by ctx.
+type AuthFunc func(ctx context.Context, password string) bool
+
+type Server struct {
+	Addr    string
+	Handler Handler
+	// Auth validates login attempts, a nil Auth rejects everyone
+	Auth AuthFunc
+	// ConnContext optionally derives the context of a new connection
+	ConnContext func(ctx context.Context, con net.Conn) context.Context
+	// BroadcastId is the packet ID used by Broadcast
+	BroadcastId int32
+
+	mu         sync.Mutex
+	listeners  map[net.Listener]struct{}
+	sessions   map[*session]struct{}
+	inShutdown atomic.Bool
+}
+
+type session struct {
+	con           net.Conn
+	writeMu       sync.Mutex
+	authenticated atomic.Bool
+	stateMu       sync.Mutex
+	busy          bool
+	closing       bool
+}
+
+// begin marks the session busy with a command, unless it is being shut down
+func (src *session) begin() bool {
+	src.stateMu.Lock()
+	defer src.stateMu.Unlock()
+	if src.closing {
+		return false
+	}
+	src.busy = true
+	return true
+}
+
+// end marks the command done and reports whether the session should keep going
+func (src *session) end() bool {
+	src.stateMu.Lock()
+	defer src.stateMu.Unlock()
+	src.busy = false
+	return !src.closing
+}
+
+// closeIfIdle flags the session for closing and closes it right away when idle
+func (src *session) closeIfIdle() {
+	src.stateMu.Lock()
+	defer src.stateMu.Unlock()
+	src.closing = true
+	if !src.busy {
+		src.con.Close()
+	}
+}
+
+func (src *session) send(id int32, body []byte) error {
+	src.writeMu.Lock()
+	defer src.writeMu.Unlock()
+	for {
+		chunk := body[:min(len(body), MaxBodySize)]
+		_, err := src.con.Write(packet.New(id, packet.SERVERDATA_RESPONSE_VALUE, chunk).Serialize())
+		if err != nil {
+			return err
+		}
+		body = body[len(chunk):]
+		if len(body) == 0 {
+			return nil
+		}
+	}
+}
+
+func (src *session) sendPacket(pkt packet.RCONPacket) error {
+	src.writeMu.Lock()
+	defer src.writeMu.Unlock()
+	_, err := src.con.Write(pkt.Serialize())
+	return err
+}
+
+type responseWriter struct {
+	bytes.Buffer
+}
+
+func (src *Server) ListenAndServe() error {
+	if src.inShutdown.Load() {
+		return ErrServerClosed
+	}
+	listener, err := net.Listen("tcp", src.Addr)
+	if err != nil {
+		return err
+	}
+	return src.Serve(listener)
+}
+
+// Serve accepts connections on listener until Shutdown or Close, it always returns a non-nil error.
+func (src *Server) Serve(listener net.Listener) error {
+	if !src.trackListener(listener, true) {
+		listener.Close()
+		return ErrServerClosed
+	}
+	defer src.trackListener(listener, false)
+	for {
+		con, err := listener.Accept()
+		if err != nil {
+			if src.inShutdown.Load() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		sess := &session{con: con}
+		if !src.trackSession(sess, true) {
+			con.Close()
+			return ErrServerClosed
+		}
+		go src.serve(sess)
+	}
+}
+
+// Broadcast sends body to every authenticated connection and returns how many got it.
+func (src *Server) Broadcast(body string) int {
+	sent := 0
+	for _, sess := range src.authenticatedSessions() {
+		if sess.send(src.BroadcastId, []byte(body)) == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
+// BroadcastPacket sends pkt unchanged, keeping its ID and type, to every authenticated
+// connection and returns how many got it.
+func (src *Server) BroadcastPacket(pkt packet.RCONPacket) int {
+	sent := 0
+	for _, sess := range src.authenticatedSessions() {
+		if sess.sendPacket(pkt) == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
+func (src *Server) authenticatedSessions() []*session {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	sessions := make([]*session, 0, len(src.sessions))
+	for sess := range src.sessions {
+		if sess.authenticated.Load() {
+			sessions = append(sessions, sess)
+		}
+	}
+	return sessions
+}
+
+// Shutdown stops accepting connections, closes idle ones and waits for in-flight
+// commands to be answered before closing the rest. If ctx ends first its error is
+// returned and the remaining connections are left for Close.
+func (src *Server) Shutdown(ctx context.Context) error {
+	src.inShutdown.Store(true)
+	src.closeListeners()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if src.closeIdle() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close immediately closes all listeners and connections.
+func (src *Server) Close() error {
+	src.inShutdown.Store(true)
+	err := src.closeListeners()
+	src.mu.Lock()
+	for sess := range src.sessions {
+		sess.con.Close()
+	}
+	src.mu.Unlock()
+	return err
+}
+
+func (src *Server) closeListeners() error {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	var err error
+	for listener := range src.listeners {
+		err = errors.Join(err, listener.Close())
+	}
+	return err
+}
+
+// closeIdle closes connections not running a handler and reports whether none are left.
+func (src *Server) closeIdle() bool {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	for sess := range src.sessions {
+		sess.closeIfIdle()
+	}
+	return len(src.sessions) == 0
+}
+
+func (src *Server) trackListener(listener net.Listener, add bool) bool {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	if src.listeners == nil {
+		src.listeners = make(map[net.Listener]struct{})
+	}
+	if !add {
+		delete(src.listeners, listener)
+		return true
+	}
+	if src.inShutdown.Load() {
+		return false
+	}
+	src.listeners[listener] = struct{}{}
+	return true
+}
+
+func (src *Server) trackSession(sess *session, add bool) bool {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	if src.sessions == nil {
+		src.sessions = make(map[*session]struct{})
+	}
+	if !add {
+		delete(src.sessions, sess)
+		return true
+	}
+	if src.inShutdown.Load() {
+		return false
+	}
+	src.sessions[sess] = struct{}{}
+	return true
+}
+
+func (src *Server) serve(sess *session) {
+	ctx := context.Background()
+	if src.ConnContext != nil {
+		ctx = src.ConnContext(ctx, sess.con)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		sess.con.Close()
+		src.trackSession(sess, false)
+	}()
+	remoteAddr := sess.con.RemoteAddr().String()
+	logger.Debug.Printf("rcon server: new connection from %v", remoteAddr)
+	for {
+		pkt, err := packet.Read(sess.con)
+		if err != nil {
+			logger.Debug.Printf("rcon server: connection from %v ended: %v", remoteAddr, err)
+			return
+		}
+		switch pkt.Type {
+		case packet.SERVERDATA_AUTH:
+			// Source servers send an empty response value ahead of the auth response
+			sess.sendPacket(packet.New(pkt.Id, packet.SERVERDATA_RESPONSE_VALUE, []byte{}))
+			if src.Auth == nil || !src.Auth(ctx, pkt.BodyStr()) {
+				logger.Debug.Printf("rcon server: failed login from %v", remoteAddr)
+				sess.sendPacket(packet.New(-1, packet.SERVERDATA_AUTH_RESPONSE, []byte{}))
+				continue
+			}
+			sess.authenticated.Store(true)
+			sess.sendPacket(packet.New(pkt.Id, packet.SERVERDATA_AUTH_RESPONSE, []byte{}))
+		case packet.SERVERDATA_EXECCOMMAND:
+			if !sess.authenticated.Load() {
+				logger.Debug.Printf("rcon server: command from unauthenticated %v, dropping connection", remoteAddr)
+				return
+			}
+			if !sess.begin() {
+				return
+			}
+			writer := &responseWriter{}
+			if src.Handler != nil {
+				src.Handler.ServeRCON(writer, &Request{
+					Id:         pkt.Id,
+					Command:    pkt.BodyStr(),
+					RemoteAddr: remoteAddr,
+					ctx:        ctx,
+				})
+			}
+			err := sess.send(pkt.Id, writer.Bytes())
+			if !sess.end() || err != nil {
+				return
+			}
+		case packet.SERVERDATA_RESPONSE_VALUE:
+			// mirror the multi-packet sentinel, followed by the trailing packet Source servers send
+			sess.sendPacket(packet.New(pkt.Id, packet.SERVERDATA_RESPONSE_VALUE, []byte{}))
+			sess.sendPacket(packet.New(pkt.Id, packet.SERVERDATA_RESPONSE_VALUE, []byte{0, 1, 0, 0}))
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/rcon"
+)
+
+func startServer(t *testing.T, handler Handler) (*Server, string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	server := &Server{
+		Handler: handler,
+		Auth: func(ctx context.Context, password string) bool {
+			return password == "secret"
+		},
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return server, listener.Addr().String()
+}
+
+func dial(t *testing.T, address string) *rcon.Client {
+	t.Helper()
+	client, err := rcon.New(address)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	ok, err := client.Authenticate(context.Background(), "secret")
+	if err != nil || !ok {
+		t.Fatalf("Authenticate failed: %v %v", ok, err)
+	}
+	return client
+}
+
+func TestServerHandler(t *testing.T) {
+	_, address := startServer(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.WriteString("you said: " + r.Command)
+	}))
+	client := dial(t, address)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	response, err := client.Execute(ctx, "hello")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if response != "you said: hello" {
+		t.Fatalf("response mismatch: got %q", response)
+	}
+}
+
+func TestServerRejectsWrongPassword(t *testing.T) {
+	_, address := startServer(t, nil)
+	client, err := rcon.New(address)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer client.Close()
+	ok, err := client.Authenticate(context.Background(), "wrong")
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if ok {
+		t.Fatal("wrong password should be rejected")
+	}
+}
+
+func TestServerSplitsLargeResponses(t *testing.T) {
+	large := strings.Repeat("0123456789", 1000)
+	_, address := startServer(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.WriteString(large)
+	}))
+	client := dial(t, address)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	first, err := client.Execute(ctx, "dump")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if len(first) != MaxBodySize {
+		t.Fatalf("first packet size mismatch: got %d want %d", len(first), MaxBodySize)
+	}
+	response, err := client.ExecuteMulti(ctx, "dump")
+	if err != nil {
+		t.Fatalf("ExecuteMulti failed: %v", err)
+	}
+	if response != large {
+		t.Fatalf("reassembled response mismatch: got %d bytes want %d", len(response), len(large))
+	}
+}
+
+func TestServerBroadcast(t *testing.T) {
+	server, address := startServer(t, nil)
+	client := dial(t, address)
+	broadcasts := client.Broadcasts()
+
+	if sent := server.Broadcast("match starting"); sent != 1 {
+		t.Fatalf("broadcast recipients mismatch: got %d want 1", sent)
+	}
+	select {
+	case pkt := <-broadcasts:
+		if pkt.BodyStr() != "match starting" {
+			t.Fatalf("broadcast mismatch: got %q", pkt.BodyStr())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("broadcast was not delivered")
+	}
+}
+
+func TestServerShutdownWaitsForHandlers(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server, address := startServer(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		close(started)
+		<-release
+		w.WriteString("done")
+	}))
+	client := dial(t, address)
+
+	result := make(chan error, 1)
+	go func() {
+		response, err := client.Execute(context.Background(), "slow")
+		if err == nil && response != "done" {
+			err = errors.New("unexpected response " + response)
+		}
+		result <- err
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- server.Shutdown(context.Background())
+	}()
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned before the handler finished: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if err := <-result; err != nil {
+		t.Fatalf("in-flight command failed: %v", err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if _, err := net.Dial("tcp", address); err == nil {
+		t.Fatal("server still accepting connections after Shutdown")
+	}
+}
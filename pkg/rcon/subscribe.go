@@ -0,0 +1,270 @@
+package rcon
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/logger"
+	"github.com/UltimateForm/tcprcon/pkg/packet"
+)
+
+const defaultSubscriptionBuffer = 32
+
+type EventKind int
+
+const (
+	// EventBroadcast is an unsolicited packet from the server, e.g. chat or a killfeed entry
+	EventBroadcast EventKind = iota
+	// EventKeepalive is the server acknowledging a keepalive outside of its command response
+	EventKeepalive
+)
+
+func (src EventKind) String() string {
+	switch src {
+	case EventBroadcast:
+		return "broadcast"
+	case EventKeepalive:
+		return "keepalive"
+	}
+	return fmt.Sprintf("EventKind(%d)", int(src))
+}
+
+type Event struct {
+	Time   time.Time
+	Packet packet.RCONPacket
+	Kind   EventKind
+	// Data holds the decoded message for protocols richer than Source RCON, nil otherwise
+	Data any
+}
+
+// EventFilter reports whether a subscriber wants an event, nil accepts everything.
+type EventFilter func(Event) bool
+
+// KindFilter accepts events of the given kinds.
+func KindFilter(kinds ...EventKind) EventFilter {
+	return func(event Event) bool {
+		return slices.Contains(kinds, event.Kind)
+	}
+}
+
+// OverflowPolicy decides what happens when a subscriber's buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowDropNewest drops the incoming event
+	OverflowDropNewest OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest buffered event to make room
+	OverflowDropOldest
+	// OverflowBlock waits for the subscriber. This stalls the connection's reader,
+	// and with it every pending command, until the subscriber catches up
+	OverflowBlock
+	// OverflowDisconnect closes the subscription, Err then reports ErrSubscriberOverflow
+	OverflowDisconnect
+)
+
+type SubscribeOption func(*Subscription)
+
+func WithBuffer(size int) SubscribeOption {
+	return func(sub *Subscription) {
+		sub.buffer = max(size, 0)
+	}
+}
+
+func WithOverflow(policy OverflowPolicy) SubscribeOption {
+	return func(sub *Subscription) {
+		sub.policy = policy
+	}
+}
+
+// Subscription is a handle on a channel returned by Subscribe.
+type Subscription struct {
+	filter  EventFilter
+	buffer  int
+	policy  OverflowPolicy
+	events  chan Event
+	dropped atomic.Uint64
+	hub     *EventHub
+
+	// sendMu serializes deliveries with closing the channel
+	sendMu   sync.Mutex
+	closed   bool
+	done     chan struct{}
+	doneOnce sync.Once
+	// err is kept apart from sendMu, which a blocked OverflowBlock delivery holds
+	err atomic.Pointer[error]
+}
+
+// Cancel stops the subscription and closes its channel.
+func (src *Subscription) Cancel() {
+	src.hub.remove(src)
+	src.close(nil)
+}
+
+// Done is closed once the subscription ends, by Cancel, overflow or the connection closing.
+func (src *Subscription) Done() <-chan struct{} {
+	return src.done
+}
+
+// Dropped returns how many events were lost to overflow.
+func (src *Subscription) Dropped() uint64 {
+	return src.dropped.Load()
+}
+
+// Err reports why the channel was closed: nil after Cancel, ErrSubscriberOverflow for
+// OverflowDisconnect, or the connection's error.
+func (src *Subscription) Err() error {
+	if err := src.err.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+func (src *Subscription) close(err error) {
+	// unblocks a pending OverflowBlock delivery before taking sendMu
+	src.doneOnce.Do(func() { close(src.done) })
+	src.sendMu.Lock()
+	defer src.sendMu.Unlock()
+	src.closeLocked(err)
+}
+
+// closeLocked must be called with sendMu held
+func (src *Subscription) closeLocked(err error) {
+	if src.closed {
+		return
+	}
+	if err != nil {
+		src.err.Store(&err)
+	}
+	src.closed = true
+	close(src.events)
+}
+
+func (src *Subscription) deliver(event Event) {
+	if src.filter != nil && !src.filter(event) {
+		return
+	}
+	src.sendMu.Lock()
+	defer src.sendMu.Unlock()
+	if src.closed {
+		return
+	}
+	select {
+	case src.events <- event:
+		return
+	default:
+	}
+	switch src.policy {
+	case OverflowBlock:
+		select {
+		case src.events <- event:
+		case <-src.done:
+		}
+	case OverflowDropOldest:
+		if cap(src.events) == 0 {
+			src.dropped.Add(1)
+			return
+		}
+		for {
+			select {
+			case <-src.events:
+				src.dropped.Add(1)
+			default:
+			}
+			select {
+			case src.events <- event:
+				return
+			default:
+			}
+		}
+	case OverflowDisconnect:
+		src.dropped.Add(1)
+		src.hub.remove(src)
+		src.doneOnce.Do(func() { close(src.done) })
+		src.closeLocked(ErrSubscriberOverflow)
+	default:
+		src.dropped.Add(1)
+	}
+}
+
+// EventHub fans events out to subscribers. It backs Subscribe on Client and
+// ReconnectingClient and is exported for other transports, e.g. pkg/battleye.
+// The zero value is ready to use.
+type EventHub struct {
+	mu     sync.Mutex
+	subs   []*Subscription
+	closed bool
+	err    error
+}
+
+// Subscribe adds a subscriber, see Client.Subscribe.
+func (src *EventHub) Subscribe(filter EventFilter, opts ...SubscribeOption) (<-chan Event, *Subscription) {
+	sub := &Subscription{
+		filter: filter,
+		buffer: defaultSubscriptionBuffer,
+		done:   make(chan struct{}),
+		hub:    src,
+	}
+	for _, opt := range opts {
+		opt(sub)
+	}
+	sub.events = make(chan Event, sub.buffer)
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	if src.closed {
+		sub.close(src.err)
+		return sub.events, sub
+	}
+	src.subs = append(src.subs, sub)
+	return sub.events, sub
+}
+
+func (src *EventHub) remove(sub *Subscription) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	if i := slices.Index(src.subs, sub); i >= 0 {
+		src.subs = slices.Delete(src.subs, i, i+1)
+	}
+}
+
+// Publish delivers event to every subscriber according to their overflow policies.
+func (src *EventHub) Publish(event Event) {
+	src.mu.Lock()
+	subs := slices.Clone(src.subs)
+	src.mu.Unlock()
+	for _, sub := range subs {
+		sub.deliver(event)
+	}
+}
+
+// Close ends every subscription with err, later subscriptions are closed right away.
+func (src *EventHub) Close(err error) {
+	src.mu.Lock()
+	if src.closed {
+		src.mu.Unlock()
+		return
+	}
+	src.closed = true
+	src.err = err
+	subs := src.subs
+	src.subs = nil
+	src.mu.Unlock()
+	for _, sub := range subs {
+		sub.close(err)
+	}
+}
+
+// forwardPackets backs the Broadcasts channels, dropping packets when out is full
+// and closing it once events is closed.
+func forwardPackets(events <-chan Event, out chan<- packet.RCONPacket) {
+	defer close(out)
+	for event := range events {
+		select {
+		case out <- event.Packet:
+		default:
+			logger.Debug.Printf("broadcast channel full, dropping packet %v", event.Packet.Id)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package rcon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/packet"
+	"github.com/UltimateForm/tcprcon/pkg/rcontest"
+)
+
+func testEvent(body string) Event {
+	return Event{Time: time.Now(), Packet: packet.New(0, packet.SERVERDATA_RESPONSE_VALUE, []byte(body))}
+}
+
+func drain(events <-chan Event) []string {
+	var bodies []string
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return bodies
+			}
+			bodies = append(bodies, event.Packet.BodyStr())
+		default:
+			return bodies
+		}
+	}
+}
+
+func TestSubscriptionOverflowPolicies(t *testing.T) {
+	cases := []struct {
+		policy  OverflowPolicy
+		want    []string
+		dropped uint64
+	}{
+		{OverflowDropNewest, []string{"0", "1"}, 2},
+		{OverflowDropOldest, []string{"2", "3"}, 2},
+	}
+	for _, tc := range cases {
+		events := &EventHub{}
+		ch, sub := events.Subscribe(nil, WithBuffer(2), WithOverflow(tc.policy))
+		for i := range 4 {
+			events.Publish(testEvent(fmt.Sprint(i)))
+		}
+		got := drain(ch)
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Fatalf("policy %v events mismatch: got %v want %v", tc.policy, got, tc.want)
+		}
+		if sub.Dropped() != tc.dropped {
+			t.Fatalf("policy %v dropped mismatch: got %v want %v", tc.policy, sub.Dropped(), tc.dropped)
+		}
+	}
+}
+
+func TestSubscriptionOverflowDisconnect(t *testing.T) {
+	events := &EventHub{}
+	ch, sub := events.Subscribe(nil, WithBuffer(1), WithOverflow(OverflowDisconnect))
+	other, _ := events.Subscribe(nil, WithBuffer(4))
+	for i := range 3 {
+		events.Publish(testEvent(fmt.Sprint(i)))
+	}
+	if got := drain(ch); len(got) != 1 {
+		t.Fatalf("expected the buffered event before disconnecting, got %v", got)
+	}
+	if _, ok := <-ch; ok {
+		t.Fatal("expected the channel to be closed")
+	}
+	if !errors.Is(sub.Err(), ErrSubscriberOverflow) {
+		t.Fatalf("expected ErrSubscriberOverflow, got %v", sub.Err())
+	}
+	// other subscribers are unaffected
+	if got := drain(other); len(got) != 3 {
+		t.Fatalf("other subscriber events mismatch: got %v want 3 events", got)
+	}
+}
+
+func TestSubscriptionOverflowBlock(t *testing.T) {
+	events := &EventHub{}
+	ch, sub := events.Subscribe(nil, WithBuffer(1), WithOverflow(OverflowBlock))
+	published := make(chan struct{})
+	go func() {
+		events.Publish(testEvent("0"))
+		events.Publish(testEvent("1"))
+		close(published)
+	}()
+	select {
+	case <-published:
+		t.Fatal("expected publish to block on a full subscriber")
+	case <-time.After(50 * time.Millisecond):
+	}
+	for _, want := range []string{"0", "1"} {
+		if got := (<-ch).Packet.BodyStr(); got != want {
+			t.Fatalf("event mismatch: got %q want %q", got, want)
+		}
+	}
+	<-published
+	if sub.Dropped() != 0 {
+		t.Fatalf("dropped mismatch: got %v want %v", sub.Dropped(), 0)
+	}
+
+	// cancelling releases a blocked publisher
+	events.Publish(testEvent("2"))
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		sub.Cancel()
+	}()
+	events.Publish(testEvent("3"))
+	if sub.Err() != nil {
+		t.Fatalf("expected no error after Cancel, got %v", sub.Err())
+	}
+}
+
+func TestSubscriptionErrWhileDeliveryBlocks(t *testing.T) {
+	events := &EventHub{}
+	ch, sub := events.Subscribe(nil, WithBuffer(0), WithOverflow(OverflowBlock))
+	go events.Publish(testEvent("0"))
+	time.Sleep(20 * time.Millisecond)
+	// a consumer checking Err from its own loop must not wait on the delivery
+	errs := make(chan error, 1)
+	go func() { errs <- sub.Err() }()
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatalf("expected no error yet, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Err blocked behind a pending delivery")
+	}
+	<-ch
+}
+
+func TestClientSubscribeClassifiesEvents(t *testing.T) {
+	srv := rcontest.NewServer("secret")
+	defer srv.Close()
+	client, err := New(srv.Addr, WithDialect(MordhauDialect))
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if ok, err := client.Authenticate(ctx, "secret"); !ok || err != nil {
+		t.Fatalf("Authenticate failed: %v %v", ok, err)
+	}
+
+	all, _ := client.Subscribe(nil)
+	chat, chatSub := client.Subscribe(KindFilter(EventBroadcast))
+	srv.Broadcast("Keeping client alive")
+	srv.Broadcast("Chat: 1234, Player, hello")
+
+	for _, want := range []EventKind{EventKeepalive, EventBroadcast} {
+		select {
+		case event := <-all:
+			if event.Kind != want {
+				t.Fatalf("kind mismatch: got %v want %v", event.Kind, want)
+			}
+			if event.Time.IsZero() {
+				t.Fatal("expected event time to be set")
+			}
+		case <-ctx.Done():
+			t.Fatal("event was not delivered")
+		}
+	}
+	select {
+	case event := <-chat:
+		if event.Packet.BodyStr() != "Chat: 1234, Player, hello" {
+			t.Fatalf("filtered event mismatch: got %q", event.Packet.BodyStr())
+		}
+	case <-ctx.Done():
+		t.Fatal("filtered event was not delivered")
+	}
+
+	chatSub.Cancel()
+	if _, ok := <-chat; ok {
+		t.Fatal("expected channel to be closed after Cancel")
+	}
+	client.Close()
+	select {
+	case _, ok := <-all:
+		if ok {
+			t.Fatal("unexpected event after close")
+		}
+	case <-ctx.Done():
+		t.Fatal("subscription was not closed with the connection")
+	}
+}
@@ -0,0 +1,337 @@
+// Package rcontest provides an in-process Source RCON server for integration tests,
+// in the spirit of net/http/httptest.
+package rcontest
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/logger"
+	"github.com/UltimateForm/tcprcon/pkg/packet"
+)
+
+// HandlerFunc scripts the answer to a command, every returned string is sent as a
+// separate SERVERDATA_RESPONSE_VALUE packet. Returning nil sends nothing at all,
+// which is handy to test timeouts.
+type HandlerFunc func(cmd string) []string
+
+type Server struct {
+	// Addr is the loopback address the server listens on, set by Start
+	Addr     string
+	Password string
+	// SkipEmptyAuthResponse stops the server from sending the empty SERVERDATA_RESPONSE_VALUE
+	// Source servers emit before the SERVERDATA_AUTH_RESPONSE
+	SkipEmptyAuthResponse bool
+	// DisableSentinelEcho makes the server ignore SERVERDATA_RESPONSE_VALUE packets
+	// instead of mirroring them like Source servers do
+	DisableSentinelEcho bool
+	// BroadcastId is the packet ID used by Broadcast
+	BroadcastId int32
+	// WrapConn, if set, wraps every accepted connection, e.g. with faultconn.WrapFunc
+	WrapConn func(net.Conn) net.Conn
+
+	listener net.Listener
+	mu       sync.Mutex
+	handlers map[string]HandlerFunc
+	fallback HandlerFunc
+	sessions map[*session]struct{}
+	received []packet.RCONPacket
+	arrived  chan struct{}
+	wg       sync.WaitGroup
+	closed   bool
+}
+
+type session struct {
+	con           net.Conn
+	writeMu       sync.Mutex
+	authenticated bool
+}
+
+func (src *session) send(pkt packet.RCONPacket) error {
+	src.writeMu.Lock()
+	defer src.writeMu.Unlock()
+	_, err := src.con.Write(pkt.Serialize())
+	return err
+}
+
+// NewServer starts a server on a random loopback port.
+func NewServer(password string) *Server {
+	server := NewUnstartedServer(password)
+	server.Start()
+	return server
+}
+
+// NewUnstartedServer returns a server that can be configured before calling Start.
+func NewUnstartedServer(password string) *Server {
+	return &Server{
+		Password: password,
+		handlers: make(map[string]HandlerFunc),
+		fallback: func(cmd string) []string {
+			return []string{fmt.Sprintf("Unknown command \"%v\"", cmd)}
+		},
+		sessions: make(map[*session]struct{}),
+		arrived:  make(chan struct{}),
+	}
+}
+
+func (src *Server) Start() {
+	if src.listener != nil {
+		panic("rcontest: server already started")
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("rcontest: failed to listen on a port: %v", err))
+	}
+	src.listener = listener
+	src.Addr = listener.Addr().String()
+	src.wg.Add(1)
+	go src.accept()
+}
+
+// Handle registers handler for command, matched case-insensitively against the whole
+// command first and then its first word, so that "kick" also handles "kick player".
+func (src *Server) Handle(command string, handler HandlerFunc) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	src.handlers[strings.ToLower(command)] = handler
+}
+
+// Respond registers a handler that always answers command with bodies.
+func (src *Server) Respond(command string, bodies ...string) {
+	src.Handle(command, func(string) []string {
+		return bodies
+	})
+}
+
+// HandleDefault replaces the handler for unregistered commands,
+// which by default answers like a Source server would.
+func (src *Server) HandleDefault(handler HandlerFunc) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	src.fallback = handler
+}
+
+// Broadcast sends body to every authenticated connection and returns how many got it.
+func (src *Server) Broadcast(body string) int {
+	src.mu.Lock()
+	sessions := make([]*session, 0, len(src.sessions))
+	for sess := range src.sessions {
+		if sess.authenticated {
+			sessions = append(sessions, sess)
+		}
+	}
+	src.mu.Unlock()
+	sent := 0
+	for _, sess := range sessions {
+		if sess.send(packet.New(src.BroadcastId, packet.SERVERDATA_RESPONSE_VALUE, []byte(body))) == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
+// Sessions returns the number of authenticated connections.
+func (src *Server) Sessions() int {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	count := 0
+	for sess := range src.sessions {
+		if sess.authenticated {
+			count++
+		}
+	}
+	return count
+}
+
+// CloseClientConnections drops every open connection while the server keeps listening.
+func (src *Server) CloseClientConnections() {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	for sess := range src.sessions {
+		sess.con.Close()
+	}
+}
+
+// Received returns every packet the server read so far, in arrival order.
+func (src *Server) Received() []packet.RCONPacket {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	received := make([]packet.RCONPacket, len(src.received))
+	copy(received, src.received)
+	return received
+}
+
+// Commands returns the bodies of the SERVERDATA_EXECCOMMAND packets received so far.
+func (src *Server) Commands() []string {
+	commands := []string{}
+	for _, pkt := range src.Received() {
+		if pkt.Type == packet.SERVERDATA_EXECCOMMAND {
+			commands = append(commands, pkt.BodyStr())
+		}
+	}
+	return commands
+}
+
+// WaitForCommand blocks until cmd was received or timeout elapsed.
+func (src *Server) WaitForCommand(cmd string, timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		src.mu.Lock()
+		arrived := src.arrived
+		src.mu.Unlock()
+		for _, received := range src.Commands() {
+			if received == cmd {
+				return true
+			}
+		}
+		select {
+		case <-arrived:
+		case <-deadline.C:
+			return false
+		}
+	}
+}
+
+// AssertReceived fails t if cmd wasn't received.
+func (src *Server) AssertReceived(t testing.TB, cmd string) {
+	t.Helper()
+	for _, received := range src.Commands() {
+		if received == cmd {
+			return
+		}
+	}
+	t.Fatalf("rcontest: command %q not received, got %q", cmd, src.Commands())
+}
+
+// AssertNotReceived fails t if cmd was received.
+func (src *Server) AssertNotReceived(t testing.TB, cmd string) {
+	t.Helper()
+	for _, received := range src.Commands() {
+		if received == cmd {
+			t.Fatalf("rcontest: command %q unexpectedly received", cmd)
+		}
+	}
+}
+
+// Close stops listening, drops every connection and waits for their goroutines.
+func (src *Server) Close() {
+	src.mu.Lock()
+	if src.closed {
+		src.mu.Unlock()
+		return
+	}
+	src.closed = true
+	for sess := range src.sessions {
+		sess.con.Close()
+	}
+	src.mu.Unlock()
+	if src.listener != nil {
+		src.listener.Close()
+	}
+	src.wg.Wait()
+}
+
+func (src *Server) accept() {
+	defer src.wg.Done()
+	for {
+		con, err := src.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Debug.Printf("rcontest: accept failed: %v", err)
+			}
+			return
+		}
+		if src.WrapConn != nil {
+			con = src.WrapConn(con)
+		}
+		sess := &session{con: con}
+		src.mu.Lock()
+		if src.closed {
+			src.mu.Unlock()
+			con.Close()
+			return
+		}
+		src.sessions[sess] = struct{}{}
+		src.mu.Unlock()
+		src.wg.Add(1)
+		go src.serve(sess)
+	}
+}
+
+func (src *Server) serve(sess *session) {
+	defer src.wg.Done()
+	defer func() {
+		src.mu.Lock()
+		delete(src.sessions, sess)
+		src.mu.Unlock()
+		sess.con.Close()
+	}()
+	for {
+		pkt, err := packet.Read(sess.con)
+		if err != nil {
+			return
+		}
+		src.record(pkt)
+		switch pkt.Type {
+		case packet.SERVERDATA_AUTH:
+			if !src.SkipEmptyAuthResponse {
+				sess.send(packet.New(pkt.Id, packet.SERVERDATA_RESPONSE_VALUE, []byte{}))
+			}
+			if pkt.BodyStr() != src.Password {
+				sess.send(packet.New(-1, packet.SERVERDATA_AUTH_RESPONSE, []byte{}))
+				continue
+			}
+			src.mu.Lock()
+			sess.authenticated = true
+			src.mu.Unlock()
+			sess.send(packet.New(pkt.Id, packet.SERVERDATA_AUTH_RESPONSE, []byte{}))
+		case packet.SERVERDATA_EXECCOMMAND:
+			if !src.isAuthenticated(sess) {
+				logger.Debug.Printf("rcontest: command %q before authentication, dropping connection", pkt.BodyStr())
+				return
+			}
+			for _, body := range src.handler(pkt.BodyStr())(pkt.BodyStr()) {
+				sess.send(packet.New(pkt.Id, packet.SERVERDATA_RESPONSE_VALUE, []byte(body)))
+			}
+		case packet.SERVERDATA_RESPONSE_VALUE:
+			if src.DisableSentinelEcho {
+				continue
+			}
+			sess.send(packet.New(pkt.Id, packet.SERVERDATA_RESPONSE_VALUE, []byte{}))
+			sess.send(packet.New(pkt.Id, packet.SERVERDATA_RESPONSE_VALUE, []byte{0, 1, 0, 0}))
+		}
+	}
+}
+
+func (src *Server) isAuthenticated(sess *session) bool {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	return sess.authenticated
+}
+
+func (src *Server) handler(cmd string) HandlerFunc {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	if handler, ok := src.handlers[strings.ToLower(cmd)]; ok {
+		return handler
+	}
+	name, _, _ := strings.Cut(strings.TrimSpace(cmd), " ")
+	if handler, ok := src.handlers[strings.ToLower(name)]; ok {
+		return handler
+	}
+	return src.fallback
+}
+
+func (src *Server) record(pkt packet.RCONPacket) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	src.received = append(src.received, pkt)
+	close(src.arrived)
+	src.arrived = make(chan struct{})
+}
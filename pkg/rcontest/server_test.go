@@ -0,0 +1,126 @@
+package rcontest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/rcon"
+)
+
+func dialAuthenticated(t *testing.T, server *Server, password string) *rcon.Client {
+	t.Helper()
+	client, err := rcon.New(server.Addr)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ok, err := client.Authenticate(ctx, password)
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if !ok {
+		t.Fatal("Authenticate rejected the password")
+	}
+	return client
+}
+
+func TestServerAuthentication(t *testing.T) {
+	server := NewServer("secret")
+	defer server.Close()
+
+	client, err := rcon.New(server.Addr)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer client.Close()
+	ok, err := client.Authenticate(context.Background(), "wrong")
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if ok {
+		t.Fatal("wrong password should be rejected")
+	}
+
+	dialAuthenticated(t, server, "secret")
+	if server.Sessions() != 1 {
+		t.Fatalf("authenticated sessions mismatch: got %d want 1", server.Sessions())
+	}
+}
+
+func TestServerHandlers(t *testing.T) {
+	server := NewServer("secret")
+	defer server.Close()
+	server.Respond("playerlist", "There are currently no players present")
+	server.Handle("kick", func(cmd string) []string {
+		return []string{"Kicked " + strings.TrimPrefix(cmd, "kick ")}
+	})
+	client := dialAuthenticated(t, server, "secret")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cases := map[string]string{
+		"playerlist": "There are currently no players present",
+		"kick Bob":   "Kicked Bob",
+		"KICK Alice": "Kicked KICK Alice",
+		"unknowncmd": "Unknown command \"unknowncmd\"",
+	}
+	for cmd, expected := range cases {
+		response, err := client.Execute(ctx, cmd)
+		if err != nil {
+			t.Fatalf("Execute(%q) failed: %v", cmd, err)
+		}
+		if response != expected {
+			t.Fatalf("response to %q mismatch: got %q want %q", cmd, response, expected)
+		}
+	}
+	server.AssertReceived(t, "kick Bob")
+	server.AssertNotReceived(t, "kick Carl")
+}
+
+func TestServerMultiPacketAndBroadcast(t *testing.T) {
+	server := NewServer("secret")
+	defer server.Close()
+	server.Respond("banlist", "ban one\n", "ban two\n", "ban three\n")
+	client := dialAuthenticated(t, server, "secret")
+	broadcasts := client.Broadcasts()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	response, err := client.ExecuteMulti(ctx, "banlist")
+	if err != nil {
+		t.Fatalf("ExecuteMulti failed: %v", err)
+	}
+	if response != "ban one\nban two\nban three\n" {
+		t.Fatalf("response mismatch: got %q", response)
+	}
+
+	if sent := server.Broadcast("Login: Bob logged in"); sent != 1 {
+		t.Fatalf("broadcast recipients mismatch: got %d want 1", sent)
+	}
+	select {
+	case pkt := <-broadcasts:
+		if pkt.BodyStr() != "Login: Bob logged in" {
+			t.Fatalf("broadcast mismatch: got %q", pkt.BodyStr())
+		}
+	case <-ctx.Done():
+		t.Fatal("broadcast was not delivered")
+	}
+}
+
+func TestServerWaitForCommand(t *testing.T) {
+	server := NewServer("secret")
+	defer server.Close()
+	server.Handle("listen", func(string) []string { return nil })
+	client := dialAuthenticated(t, server, "secret")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	go client.Execute(ctx, "listen chat")
+	if !server.WaitForCommand("listen chat", 5*time.Second) {
+		t.Fatal("command was not received in time")
+	}
+}
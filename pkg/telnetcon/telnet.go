@@ -0,0 +1,74 @@
+package telnetcon
+
+const (
+	iac  byte = 255
+	dont byte = 254
+	do   byte = 253
+	wont byte = 252
+	will byte = 251
+	sb   byte = 250
+	se   byte = 240
+)
+
+const (
+	stateData = iota
+	stateIAC
+	stateOption
+	stateSub
+	stateSubIAC
+)
+
+// stripper removes telnet commands from a byte stream, refusing every option the server
+// offers or requests. It keeps its state across reads since sequences may be split.
+type stripper struct {
+	state int
+	verb  byte
+}
+
+// strip returns the data bytes of in and the replies owed to the server
+func (src *stripper) strip(in []byte) ([]byte, []byte) {
+	out := make([]byte, 0, len(in))
+	var replies []byte
+	for _, b := range in {
+		switch src.state {
+		case stateData:
+			if b == iac {
+				src.state = stateIAC
+				continue
+			}
+			out = append(out, b)
+		case stateIAC:
+			switch b {
+			case iac:
+				out = append(out, iac)
+				src.state = stateData
+			case do, dont, will, wont:
+				src.verb = b
+				src.state = stateOption
+			case sb:
+				src.state = stateSub
+			default:
+				src.state = stateData
+			}
+		case stateOption:
+			switch src.verb {
+			case do:
+				replies = append(replies, iac, wont, b)
+			case will:
+				replies = append(replies, iac, dont, b)
+			}
+			src.state = stateData
+		case stateSub:
+			if b == iac {
+				src.state = stateSubIAC
+			}
+		case stateSubIAC:
+			if b == se {
+				src.state = stateData
+			} else {
+				src.state = stateSub
+			}
+		}
+	}
+	return out, replies
+}
@@ -0,0 +1,372 @@
+// Package telnetcon drives line oriented telnet admin consoles, such as the one of
+// 7 Days to Die servers, with the same Execute and Subscribe shape as rcon.Client.
+package telnetcon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/logger"
+	"github.com/UltimateForm/tcprcon/pkg/packet"
+	"github.com/UltimateForm/tcprcon/pkg/rcon"
+)
+
+const (
+	DefaultQuietPeriod = 500 * time.Millisecond
+	DefaultTimeout     = 5 * time.Second
+)
+
+var (
+	ErrClientClosed error = errors.New("telnet client closed")
+)
+
+var (
+	_ rcon.Executor      = (*Client)(nil)
+	_ rcon.Subscriber    = (*Client)(nil)
+	_ rcon.Authenticator = (*Client)(nil)
+)
+
+type command struct {
+	lines  []string
+	tail   string
+	prompt bool
+	notify chan struct{}
+}
+
+func newCommand() *command {
+	return &command{notify: make(chan struct{}, 1)}
+}
+
+func (src *command) signal() {
+	select {
+	case src.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Client is a telnet console connection. Commands run one at a time since responses
+// aren't tagged, output arriving between commands is delivered through Subscribe.
+type Client struct {
+	Address string
+
+	prompt      string
+	quietPeriod time.Duration
+	timeout     time.Duration
+
+	con     net.Conn
+	writeMu sync.Mutex
+	execMu  sync.Mutex
+	mu      sync.Mutex
+	active  *command
+	events  *rcon.EventHub
+
+	closeOnce sync.Once
+	closed    atomic.Bool
+	done      chan struct{}
+	err       error
+}
+
+type Option func(*Client)
+
+// WithPrompt ends responses at prompt, e.g. "> ", instead of waiting for the quiet period.
+func WithPrompt(prompt string) Option {
+	return func(client *Client) {
+		client.prompt = prompt
+	}
+}
+
+// WithQuietPeriod ends a response once no line arrived for period after the first one.
+// Defaults to DefaultQuietPeriod.
+func WithQuietPeriod(period time.Duration) Option {
+	return func(client *Client) {
+		if period > 0 {
+			client.quietPeriod = period
+		}
+	}
+}
+
+// WithTimeout bounds the wait for the first line of a response, it is also how long a
+// command without output takes when there's no prompt. Defaults to DefaultTimeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(client *Client) {
+		if timeout > 0 {
+			client.timeout = timeout
+		}
+	}
+}
+
+// New dials address over TCP and starts reading, the client must then Authenticate.
+func New(address string, opts ...Option) (*Client, error) {
+	con, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromConn(address, con, opts...), nil
+}
+
+func NewFromConn(address string, con net.Conn, opts ...Option) *Client {
+	client := &Client{
+		Address:     address,
+		quietPeriod: DefaultQuietPeriod,
+		timeout:     DefaultTimeout,
+		con:         con,
+		events:      &rcon.EventHub{},
+		done:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(client)
+	}
+	go client.readLoop()
+	return client
+}
+
+// Authenticate waits for the server's password prompt and answers it, false means the
+// password was rejected. An empty password skips the exchange for consoles without one.
+func (src *Client) Authenticate(ctx context.Context, password string) (bool, error) {
+	if password == "" {
+		return true, nil
+	}
+	src.execMu.Lock()
+	defer src.execMu.Unlock()
+	cmd := src.begin()
+	defer src.end()
+
+	prompt, err := src.waitFor(ctx, cmd, isPasswordPrompt)
+	if err != nil {
+		return false, err
+	}
+	cmd = src.begin()
+	if err := src.writeLine(password); err != nil {
+		return false, err
+	}
+	// a prompt matched before its line ending arrived shows up once more as a full line
+	repeated := false
+	line, err := src.waitFor(ctx, cmd, func(line string) bool {
+		if line == prompt && !repeated {
+			repeated = true
+			return false
+		}
+		return isLoginResult(line) || isPasswordPrompt(line)
+	})
+	if err != nil {
+		return false, err
+	}
+	return isLoginResult(line) && !strings.Contains(strings.ToLower(line), "incorrect"), nil
+}
+
+// Execute sends cmd and returns the lines received until the prompt, or until the
+// quiet period passed without output. The quiet period starts with the first line of
+// the response, until then a slow server gets the client's timeout.
+func (src *Client) Execute(ctx context.Context, cmd string) (string, error) {
+	src.execMu.Lock()
+	defer src.execMu.Unlock()
+	pending := src.begin()
+	defer src.end()
+	if err := src.writeLine(cmd); err != nil {
+		return "", errors.Join(rcon.ErrWriteFailed, err)
+	}
+	timer := time.NewTimer(src.timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-pending.notify:
+			src.mu.Lock()
+			prompt := pending.prompt
+			// the console echoing the command back isn't the response yet
+			started := pending.tail != "" || len(pending.lines) > 1 || len(pending.lines) == 1 && pending.lines[0] != cmd
+			src.mu.Unlock()
+			if prompt {
+				return src.response(pending, cmd), nil
+			}
+			if started {
+				timer.Reset(src.quietPeriod)
+			}
+		case <-timer.C:
+			return src.response(pending, cmd), nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-src.done:
+			return "", src.err
+		}
+	}
+}
+
+// ExecuteMulti is Execute, responses are always collected whole. It lets the client
+// stand in wherever an rcon.Client's ExecuteMulti is expected.
+func (src *Client) ExecuteMulti(ctx context.Context, cmd string) (string, error) {
+	return src.Execute(ctx, cmd)
+}
+
+// Subscribe returns the lines printed outside of a command, e.g. 7 Days to Die's log, as
+// rcon events. See rcon.Client.Subscribe for the options.
+func (src *Client) Subscribe(filter rcon.EventFilter, opts ...rcon.SubscribeOption) (<-chan rcon.Event, *rcon.Subscription) {
+	return src.events.Subscribe(filter, opts...)
+}
+
+// Done is closed once the connection ends, after which Err reports why.
+func (src *Client) Done() <-chan struct{} {
+	return src.done
+}
+
+func (src *Client) Err() error {
+	select {
+	case <-src.done:
+		return src.err
+	default:
+		return nil
+	}
+}
+
+func (src *Client) Close() error {
+	src.closed.Store(true)
+	return src.con.Close()
+}
+
+func (src *Client) begin() *command {
+	cmd := newCommand()
+	src.mu.Lock()
+	src.active = cmd
+	src.mu.Unlock()
+	return cmd
+}
+
+func (src *Client) end() {
+	src.mu.Lock()
+	src.active = nil
+	src.mu.Unlock()
+}
+
+// response joins the collected lines, dropping the command if the console echoed it
+func (src *Client) response(pending *command, cmd string) string {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	lines := pending.lines
+	if len(lines) > 0 && lines[0] == cmd {
+		lines = lines[1:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// waitFor returns the first line, or unterminated tail, matching match
+func (src *Client) waitFor(ctx context.Context, cmd *command, match func(string) bool) (string, error) {
+	seen := 0
+	for {
+		src.mu.Lock()
+		lines, tail := cmd.lines[seen:], cmd.tail
+		seen = len(cmd.lines)
+		src.mu.Unlock()
+		for _, line := range append(lines, tail) {
+			if match(line) {
+				return line, nil
+			}
+		}
+		select {
+		case <-cmd.notify:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-src.done:
+			return "", src.err
+		}
+	}
+}
+
+func (src *Client) writeLine(line string) error {
+	src.writeMu.Lock()
+	defer src.writeMu.Unlock()
+	_, err := src.con.Write([]byte(line + "\r\n"))
+	return err
+}
+
+func (src *Client) readLoop() {
+	var telnet stripper
+	var partial []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := src.con.Read(buf)
+		if err != nil {
+			src.finish(err)
+			return
+		}
+		data, replies := telnet.strip(buf[:n])
+		if len(replies) > 0 {
+			src.writeMu.Lock()
+			_, err := src.con.Write(replies)
+			src.writeMu.Unlock()
+			if err != nil {
+				logger.Debug.Printf("telnet: failed to refuse options from %v: %v", src.Address, err)
+			}
+		}
+		partial = append(partial, data...)
+		var lines []string
+		for {
+			end := bytes.IndexAny(partial, "\r\n")
+			if end < 0 {
+				break
+			}
+			lines = append(lines, string(partial[:end]))
+			if partial[end] == '\r' && end+1 < len(partial) && partial[end+1] == '\n' {
+				end++
+			}
+			partial = partial[end+1:]
+		}
+		prompt := src.prompt != "" && strings.HasSuffix(string(partial), src.prompt)
+		if prompt {
+			partial = partial[:0]
+		}
+		src.dispatch(lines, string(partial), prompt)
+	}
+}
+
+func (src *Client) dispatch(lines []string, tail string, prompt bool) {
+	src.mu.Lock()
+	cmd := src.active
+	if cmd != nil {
+		cmd.lines = append(cmd.lines, lines...)
+		cmd.tail = tail
+		cmd.prompt = cmd.prompt || prompt
+	}
+	src.mu.Unlock()
+	if cmd != nil {
+		cmd.signal()
+		return
+	}
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		src.events.Publish(rcon.Event{
+			Time:   time.Now(),
+			Packet: packet.New(0, packet.SERVERDATA_RESPONSE_VALUE, []byte(line)),
+			Kind:   rcon.EventBroadcast,
+		})
+	}
+}
+
+func (src *Client) finish(err error) {
+	src.closeOnce.Do(func() {
+		if src.closed.Load() {
+			err = ErrClientClosed
+		}
+		logger.Debug.Printf("telnet: connection to %v ended: %v", src.Address, err)
+		src.err = err
+		src.con.Close()
+		close(src.done)
+		src.events.Close(err)
+	})
+}
+
+func isPasswordPrompt(line string) bool {
+	return strings.Contains(strings.ToLower(line), "password")
+}
+
+// isLoginResult recognises 7 Days to Die's "Logon successful." and "Password incorrect"
+func isLoginResult(line string) bool {
+	line = strings.ToLower(line)
+	return strings.Contains(line, "successful") || strings.Contains(line, "incorrect")
+}
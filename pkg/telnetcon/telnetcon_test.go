@@ -0,0 +1,238 @@
+package telnetcon
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer mimics a 7 Days to Die telnet console, or a prompting console when prompt is set
+type fakeServer struct {
+	listener net.Listener
+	password string
+	prompt   string
+	mu       sync.Mutex
+	conns    []net.Conn
+	replies  [][]byte
+}
+
+func newFakeServer(t *testing.T, password string, prompt string) *fakeServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &fakeServer{listener: listener, password: password, prompt: prompt}
+	t.Cleanup(func() {
+		listener.Close()
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		for _, con := range srv.conns {
+			con.Close()
+		}
+	})
+	go func() {
+		for {
+			con, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			srv.mu.Lock()
+			srv.conns = append(srv.conns, con)
+			srv.mu.Unlock()
+			go srv.serve(con)
+		}
+	}()
+	return srv
+}
+
+func (src *fakeServer) serve(con net.Conn) {
+	// offer to echo, then split the prompt from its line ending
+	con.Write([]byte{iac, will, 1})
+	con.Write([]byte("Please enter password:"))
+	time.Sleep(10 * time.Millisecond)
+	con.Write([]byte("\r\n"))
+	reader := bufio.NewReader(con)
+	reply := make([]byte, 3)
+	if _, err := io.ReadFull(reader, reply); err != nil {
+		return
+	}
+	src.mu.Lock()
+	src.replies = append(src.replies, reply)
+	src.mu.Unlock()
+	loggedIn := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if !loggedIn {
+			if line != src.password {
+				con.Write([]byte("Password incorrect, please enter password:\r\n"))
+				continue
+			}
+			loggedIn = true
+			con.Write([]byte("Logon successful.\r\n\r\n*** Connected with 7DTD server.\r\n"))
+			if src.prompt != "" {
+				con.Write([]byte(src.prompt))
+			}
+			continue
+		}
+		switch line {
+		case "version":
+			con.Write([]byte("Game version: V 1.0\r\nMod TFP_CommandExtensions: 1.0\r\n"))
+		case "lagging":
+			// echoes the command, then answers well after the client's quiet period
+			con.Write([]byte("lagging\r\n"))
+			time.Sleep(300 * time.Millisecond)
+			con.Write([]byte("late answer\r\n"))
+		case "slow":
+			for i := range 3 {
+				time.Sleep(20 * time.Millisecond)
+				fmt.Fprintf(con, "part %v\r\n", i)
+			}
+		}
+		if src.prompt != "" {
+			con.Write([]byte(src.prompt))
+		}
+	}
+}
+
+func (src *fakeServer) log(line string) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	for _, con := range src.conns {
+		con.Write([]byte(line + "\r\n"))
+	}
+}
+
+func connect(t *testing.T, srv *fakeServer, password string, quiet time.Duration) (*Client, bool) {
+	t.Helper()
+	client, err := New(srv.listener.Addr().String(), WithPrompt(srv.prompt), WithQuietPeriod(quiet))
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ok, err := client.Authenticate(ctx, password)
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	return client, ok
+}
+
+func TestStripper(t *testing.T) {
+	var telnet stripper
+	input := []byte{'a', iac, do, 24, 'b', iac, iac, iac, sb, 24, 1, iac, se, 'c', iac}
+	data, replies := telnet.strip(input)
+	if string(data) != "ab\xffc" {
+		t.Fatalf("data mismatch: got %q want %q", data, "ab\xffc")
+	}
+	if !bytes.Equal(replies, []byte{iac, wont, 24}) {
+		t.Fatalf("replies mismatch: got %v want %v", replies, []byte{iac, wont, 24})
+	}
+	// the trailing IAC continues in the next read
+	data, replies = telnet.strip([]byte{will, 1, 'd'})
+	if string(data) != "d" || !bytes.Equal(replies, []byte{iac, dont, 1}) {
+		t.Fatalf("split sequence mismatch: got %q %v", data, replies)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	srv := newFakeServer(t, "secret", "")
+	if _, ok := connect(t, srv, "wrong", 100*time.Millisecond); ok {
+		t.Fatal("expected wrong password to be rejected")
+	}
+	if _, ok := connect(t, srv, "secret", 100*time.Millisecond); !ok {
+		t.Fatal("expected login to succeed")
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if len(srv.replies) == 0 || !bytes.Equal(srv.replies[0], []byte{iac, dont, 1}) {
+		t.Fatalf("expected the echo offer to be refused, got %v", srv.replies)
+	}
+}
+
+func TestExecuteQuietPeriod(t *testing.T) {
+	srv := newFakeServer(t, "secret", "")
+	client, _ := connect(t, srv, "secret", 100*time.Millisecond)
+	// let the login banner pass
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	response, err := client.Execute(ctx, "slow")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if response != "part 0\npart 1\npart 2" {
+		t.Fatalf("response mismatch: got %q", response)
+	}
+}
+
+func TestExecuteWaitsForSlowServer(t *testing.T) {
+	srv := newFakeServer(t, "secret", "")
+	client, _ := connect(t, srv, "secret", 100*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// the late answer must not leak into the next command
+	for _, tc := range []struct{ cmd, want string }{
+		{"lagging", "late answer"},
+		{"version", "Game version: V 1.0\nMod TFP_CommandExtensions: 1.0"},
+	} {
+		cmd, want := tc.cmd, tc.want
+		response, err := client.Execute(ctx, cmd)
+		if err != nil {
+			t.Fatalf("Execute(%q) failed: %v", cmd, err)
+		}
+		if response != want {
+			t.Fatalf("%v response mismatch: got %q want %q", cmd, response, want)
+		}
+	}
+}
+
+func TestExecutePrompt(t *testing.T) {
+	srv := newFakeServer(t, "secret", "> ")
+	client, _ := connect(t, srv, "secret", 5*time.Second)
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	response, err := client.Execute(ctx, "version")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if response != "Game version: V 1.0\nMod TFP_CommandExtensions: 1.0" {
+		t.Fatalf("response mismatch: got %q", response)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("expected the prompt to end the response before the quiet period")
+	}
+}
+
+func TestSubscribeLogLines(t *testing.T) {
+	srv := newFakeServer(t, "secret", "")
+	client, _ := connect(t, srv, "secret", 100*time.Millisecond)
+	events, _ := client.Subscribe(nil)
+	time.Sleep(50 * time.Millisecond)
+	srv.log("2024-01-01T00:00:00 INF Player connected, entityid=171")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	select {
+	case event := <-events:
+		if !strings.Contains(event.Packet.BodyStr(), "Player connected") {
+			t.Fatalf("event mismatch: got %q", event.Packet.BodyStr())
+		}
+	case <-ctx.Done():
+		t.Fatal("log line was not delivered")
+	}
+}
@@ -0,0 +1,256 @@
+// Package udprcon implements the connectionless rcon used by GoldSrc (Half-Life 1), Quake 3
+// and Call of Duty servers: every command is a single "\xFF\xFF\xFF\xFFrcon ..." datagram
+// carrying the password, answered by one or more print datagrams.
+package udprcon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/pkg/logger"
+	"github.com/UltimateForm/tcprcon/pkg/rcon"
+)
+
+type Flavor int
+
+const (
+	// FlavorGoldSrc fetches a challenge with "challenge rcon" and quotes the password
+	FlavorGoldSrc Flavor = iota
+	// FlavorQuake3 sends the password as is, also used by Call of Duty servers
+	FlavorQuake3
+)
+
+func (src Flavor) String() string {
+	switch src {
+	case FlavorGoldSrc:
+		return "goldsrc"
+	case FlavorQuake3:
+		return "quake3"
+	default:
+		return fmt.Sprintf("Flavor(%d)", int(src))
+	}
+}
+
+const (
+	DefaultTimeout     = 5 * time.Second
+	DefaultQuietPeriod = 250 * time.Millisecond
+	maxDatagram        = 65535
+)
+
+var header = []byte{0xFF, 0xFF, 0xFF, 0xFF}
+
+var (
+	ErrBadPassword   error = errors.New("rcon password rejected")
+	ErrBadChallenge  error = errors.New("rcon challenge rejected")
+	ErrRconDisabled  error = errors.New("rcon is disabled on the server")
+	ErrNoResponse    error = errors.New("server did not respond")
+	ErrInvalidPacket error = errors.New("not a connectionless packet")
+)
+
+var _ rcon.Executor = (*Client)(nil)
+
+// Client sends rcon commands to a single server. Responses carry no request id, so
+// commands run one at a time.
+type Client struct {
+	Address  string
+	Flavor   Flavor
+	Password string
+	// Timeout bounds the wait for the first datagram of a response when ctx has no earlier deadline
+	Timeout time.Duration
+	// QuietPeriod is how long to wait for further datagrams once a response started arriving
+	QuietPeriod time.Duration
+
+	con       net.Conn
+	mu        sync.Mutex
+	challenge string
+}
+
+// New dials address over UDP, nothing is sent until the first command.
+func New(address string, password string, flavor Flavor) (*Client, error) {
+	con, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromConn(address, password, flavor, con), nil
+}
+
+func NewFromConn(address string, password string, flavor Flavor, con net.Conn) *Client {
+	return &Client{
+		Address:     address,
+		Flavor:      flavor,
+		Password:    password,
+		Timeout:     DefaultTimeout,
+		QuietPeriod: DefaultQuietPeriod,
+		con:         con,
+	}
+}
+
+// Execute runs cmd and returns the concatenated response. A stale GoldSrc challenge is
+// refreshed once before giving up with ErrBadChallenge.
+func (src *Client) Execute(ctx context.Context, cmd string) (string, error) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	for attempt := 0; ; attempt++ {
+		if src.Flavor == FlavorGoldSrc && src.challenge == "" {
+			if err := src.fetchChallenge(ctx); err != nil {
+				return "", err
+			}
+		}
+		response, err := src.roundTrip(ctx, src.command(cmd))
+		if err != nil {
+			return "", err
+		}
+		err = classify(response)
+		if errors.Is(err, ErrBadChallenge) && src.Flavor == FlavorGoldSrc && attempt == 0 {
+			logger.Debug.Printf("udprcon: challenge for %v expired, fetching a new one", src.Address)
+			src.challenge = ""
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return response, nil
+	}
+}
+
+// ExecuteMulti is Execute, replies are always reassembled. It lets the client stand in
+// wherever an rcon.Client's ExecuteMulti is expected.
+func (src *Client) ExecuteMulti(ctx context.Context, cmd string) (string, error) {
+	return src.Execute(ctx, cmd)
+}
+
+func (src *Client) Close() error {
+	return src.con.Close()
+}
+
+func (src *Client) command(cmd string) []byte {
+	if src.Flavor == FlavorGoldSrc {
+		return fmt.Appendf(bytes.Clone(header), "rcon %v \"%v\" %v\n", src.challenge, src.Password, cmd)
+	}
+	return fmt.Appendf(bytes.Clone(header), "rcon %v %v", src.Password, cmd)
+}
+
+func (src *Client) fetchChallenge(ctx context.Context) error {
+	response, err := src.roundTrip(ctx, append(bytes.Clone(header), "challenge rcon\n"...))
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(response)
+	if len(fields) != 3 || fields[0] != "challenge" || fields[1] != "rcon" {
+		if err := classify(response); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: unexpected challenge reply %q", ErrBadChallenge, response)
+	}
+	src.challenge = fields[2]
+	return nil
+}
+
+// roundTrip writes request and collects reply datagrams until QuietPeriod passes without one
+func (src *Client) roundTrip(ctx context.Context, request []byte) (string, error) {
+	stop := context.AfterFunc(ctx, func() {
+		src.con.SetReadDeadline(time.Now())
+	})
+	defer stop()
+	buf := make([]byte, maxDatagram)
+	src.drain(buf)
+	if _, err := src.con.Write(request); err != nil {
+		return "", err
+	}
+	timeout := src.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	quiet := src.QuietPeriod
+	if quiet <= 0 {
+		quiet = DefaultQuietPeriod
+	}
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	var response strings.Builder
+	received := false
+	for {
+		src.con.SetReadDeadline(deadline)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		n, err := src.con.Read(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			if !received {
+				return "", ErrNoResponse
+			}
+			return response.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		body, err := Payload(buf[:n])
+		if err != nil {
+			logger.Debug.Printf("udprcon: dropping datagram from %v: %v", src.Address, err)
+			continue
+		}
+		response.WriteString(body)
+		received = true
+		deadline = time.Now().Add(quiet)
+	}
+}
+
+// drain discards datagrams left over from earlier requests, such as the tail of a reply
+// that outlasted the quiet period or one that arrived after its request timed out.
+// An expired deadline fails before reading, so a short one lets queued datagrams through
+func (src *Client) drain(buf []byte) {
+	for {
+		src.con.SetReadDeadline(time.Now().Add(time.Millisecond))
+		n, err := src.con.Read(buf)
+		if err != nil {
+			return
+		}
+		logger.Debug.Printf("udprcon: discarding %v stale bytes from %v", n, src.Address)
+	}
+}
+
+// Payload strips the connectionless header and the print marker ("l" on GoldSrc,
+// "print\n" on Quake 3) from a reply datagram.
+func Payload(data []byte) (string, error) {
+	body, ok := bytes.CutPrefix(data, header)
+	if !ok {
+		return "", ErrInvalidPacket
+	}
+	if rest, ok := bytes.CutPrefix(body, []byte("print\n")); ok {
+		return string(rest), nil
+	}
+	if rest, ok := bytes.CutPrefix(body, []byte("l")); ok {
+		return string(rest), nil
+	}
+	return string(body), nil
+}
+
+// classify turns the servers' error replies into typed errors
+func classify(response string) error {
+	line := strings.TrimSpace(response)
+	switch {
+	case strings.HasPrefix(line, "Bad rcon_password"),
+		strings.HasPrefix(line, "Bad rconpassword"),
+		strings.HasPrefix(line, "Invalid password"):
+		return ErrBadPassword
+	case strings.HasPrefix(line, "Bad challenge"):
+		return ErrBadChallenge
+	case strings.HasPrefix(line, "No rconpassword set"),
+		strings.HasPrefix(line, "The server must set 'rcon_password'"):
+		return ErrRconDisabled
+	}
+	return nil
+}
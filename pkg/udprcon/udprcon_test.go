@@ -0,0 +1,254 @@
+package udprcon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer answers connectionless rcon on a loopback UDP socket
+type fakeServer struct {
+	con        net.PacketConn
+	flavor     Flavor
+	password   string
+	mu         sync.Mutex
+	challenge  string
+	challenges int
+}
+
+func newFakeServer(t *testing.T, flavor Flavor, password string) *fakeServer {
+	t.Helper()
+	con, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &fakeServer{con: con, flavor: flavor, password: password, challenge: "1111"}
+	t.Cleanup(func() { con.Close() })
+	go srv.serve()
+	return srv
+}
+
+func (src *fakeServer) reply(addr net.Addr, body string) {
+	marker := "l"
+	if src.flavor == FlavorQuake3 {
+		marker = "print\n"
+	}
+	src.con.WriteTo(append(bytes.Clone(header), marker+body...), addr)
+}
+
+func (src *fakeServer) serve() {
+	buf := make([]byte, maxDatagram)
+	for {
+		n, addr, err := src.con.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		request, ok := bytes.CutPrefix(buf[:n], header)
+		if !ok {
+			continue
+		}
+		line := strings.TrimSuffix(string(request), "\n")
+		if line == "challenge rcon" {
+			src.mu.Lock()
+			src.challenges++
+			challenge := src.challenge
+			src.mu.Unlock()
+			src.con.WriteTo(append(bytes.Clone(header), "challenge rcon "+challenge+"\n"...), addr)
+			continue
+		}
+		fields := strings.SplitN(line, " ", 4)
+		var password, cmd string
+		if src.flavor == FlavorGoldSrc {
+			if len(fields) < 4 {
+				continue
+			}
+			src.mu.Lock()
+			challenge := src.challenge
+			src.mu.Unlock()
+			if fields[1] != challenge {
+				src.reply(addr, "Bad challenge.\n")
+				continue
+			}
+			password, cmd = strings.Trim(fields[2], "\""), fields[3]
+		} else {
+			fields = strings.SplitN(line, " ", 3)
+			if len(fields) < 3 {
+				continue
+			}
+			password, cmd = fields[1], fields[2]
+		}
+		if password != src.password {
+			if src.flavor == FlavorGoldSrc {
+				src.reply(addr, "Bad rcon_password.\n")
+			} else {
+				src.reply(addr, "Bad rconpassword.\n")
+			}
+			continue
+		}
+		switch cmd {
+		case "status":
+			for _, part := range []string{"hostname: test\n", "players : 2\n", "map     : de_dust2\n"} {
+				src.reply(addr, part)
+			}
+		case "silent":
+		case "slow":
+			// the tail outlasts the client's quiet period
+			src.reply(addr, "first part\n")
+			time.AfterFunc(150*time.Millisecond, func() { src.reply(addr, "late tail\n") })
+		default:
+			src.reply(addr, "echo "+cmd+"\n")
+		}
+	}
+}
+
+func (src *fakeServer) rotateChallenge(challenge string) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	src.challenge = challenge
+}
+
+func dial(t *testing.T, srv *fakeServer, password string) *Client {
+	t.Helper()
+	client, err := New(srv.con.LocalAddr().String(), password, srv.flavor)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	client.QuietPeriod = 50 * time.Millisecond
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestGoldSrcExecute(t *testing.T) {
+	srv := newFakeServer(t, FlavorGoldSrc, "secret")
+	client := dial(t, srv, "secret")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for range 2 {
+		response, err := client.Execute(ctx, "say hi")
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		if response != "echo say hi\n" {
+			t.Fatalf("response mismatch: got %q want %q", response, "echo say hi\n")
+		}
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.challenges != 1 {
+		t.Fatalf("challenge count mismatch: got %v want %v", srv.challenges, 1)
+	}
+}
+
+func TestGoldSrcRefreshesChallenge(t *testing.T) {
+	srv := newFakeServer(t, FlavorGoldSrc, "secret")
+	client := dial(t, srv, "secret")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.Execute(ctx, "say hi"); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	srv.rotateChallenge("2222")
+	response, err := client.Execute(ctx, "say again")
+	if err != nil {
+		t.Fatalf("Execute after challenge change failed: %v", err)
+	}
+	if response != "echo say again\n" {
+		t.Fatalf("response mismatch: got %q want %q", response, "echo say again\n")
+	}
+}
+
+func TestMultiDatagramResponse(t *testing.T) {
+	for _, flavor := range []Flavor{FlavorGoldSrc, FlavorQuake3} {
+		srv := newFakeServer(t, flavor, "secret")
+		client := dial(t, srv, "secret")
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		response, err := client.Execute(ctx, "status")
+		cancel()
+		if err != nil {
+			t.Fatalf("%v Execute failed: %v", flavor, err)
+		}
+		want := "hostname: test\nplayers : 2\nmap     : de_dust2\n"
+		if response != want {
+			t.Fatalf("%v response mismatch: got %q want %q", flavor, response, want)
+		}
+	}
+}
+
+func TestLateDatagramsAreDiscarded(t *testing.T) {
+	srv := newFakeServer(t, FlavorGoldSrc, "secret")
+	client := dial(t, srv, "secret")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	response, err := client.Execute(ctx, "slow")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if response != "first part\n" {
+		t.Fatalf("response mismatch: got %q want %q", response, "first part\n")
+	}
+	time.Sleep(300 * time.Millisecond)
+	response, err = client.Execute(ctx, "say hi")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if response != "echo say hi\n" {
+		t.Fatalf("response mismatch: got %q want %q", response, "echo say hi\n")
+	}
+}
+
+func TestBadPassword(t *testing.T) {
+	for _, flavor := range []Flavor{FlavorGoldSrc, FlavorQuake3} {
+		srv := newFakeServer(t, flavor, "secret")
+		client := dial(t, srv, "wrong")
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := client.Execute(ctx, "status")
+		cancel()
+		if !errors.Is(err, ErrBadPassword) {
+			t.Fatalf("%v: expected ErrBadPassword, got %v", flavor, err)
+		}
+	}
+}
+
+func TestNoResponse(t *testing.T) {
+	srv := newFakeServer(t, FlavorQuake3, "secret")
+	client := dial(t, srv, "secret")
+	client.Timeout = 50 * time.Millisecond
+	if _, err := client.Execute(context.Background(), "silent"); !errors.Is(err, ErrNoResponse) {
+		t.Fatalf("expected ErrNoResponse, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client.Timeout = 5 * time.Second
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := client.Execute(ctx, "silent"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestPayload(t *testing.T) {
+	cases := []struct {
+		data string
+		want string
+	}{
+		{"\xFF\xFF\xFF\xFFlhello", "hello"},
+		{"\xFF\xFF\xFF\xFFprint\nhello", "hello"},
+		{"\xFF\xFF\xFF\xFFhello", "hello"},
+	}
+	for _, tc := range cases {
+		got, err := Payload([]byte(tc.data))
+		if err != nil {
+			t.Fatalf("Payload(%q) failed: %v", tc.data, err)
+		}
+		if got != tc.want {
+			t.Fatalf("payload mismatch: got %q want %q", got, tc.want)
+		}
+	}
+	if _, err := Payload([]byte("hello")); !errors.Is(err, ErrInvalidPacket) {
+		t.Fatalf("expected ErrInvalidPacket, got %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+// Package webrcon implements Rust's WebRCON: JSON messages over a websocket, with
+// responses matched to commands by their Identifier.
+package webrcon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/internal/websocket"
+	"github.com/UltimateForm/tcprcon/pkg/logger"
+	"github.com/UltimateForm/tcprcon/pkg/packet"
+	"github.com/UltimateForm/tcprcon/pkg/rcon"
+)
+
+const DefaultName = "WebRcon"
+
+type MessageType string
+
+const (
+	MessageGeneric MessageType = "Generic"
+	MessageChat    MessageType = "Chat"
+	MessageWarning MessageType = "Warning"
+	MessageError   MessageType = "Error"
+)
+
+var (
+	ErrClientClosed error = errors.New("webrcon client closed")
+	ErrNotChat      error = errors.New("not a chat message")
+)
+
+// Message is what the server sends, Identifier is 0 or negative for unsolicited output.
+type Message struct {
+	Identifier int         `json:"Identifier"`
+	Message    string      `json:"Message"`
+	Type       MessageType `json:"Type"`
+	Stacktrace string      `json:"Stacktrace,omitempty"`
+}
+
+// ChatMessage is the JSON body of a Chat message.
+type ChatMessage struct {
+	Channel  int    `json:"Channel"`
+	Message  string `json:"Message"`
+	UserId   string `json:"UserId"`
+	Username string `json:"Username"`
+	Color    string `json:"Color"`
+	Time     int64  `json:"Time"`
+}
+
+// Chat decodes the body of a Chat message.
+func (src Message) Chat() (ChatMessage, error) {
+	var chat ChatMessage
+	if src.Type != MessageChat {
+		return chat, ErrNotChat
+	}
+	err := json.Unmarshal([]byte(src.Message), &chat)
+	return chat, err
+}
+
+var (
+	_ rcon.Executor   = (*Client)(nil)
+	_ rcon.Subscriber = (*Client)(nil)
+)
+
+type request struct {
+	Identifier int    `json:"Identifier"`
+	Message    string `json:"Message"`
+	Name       string `json:"Name"`
+}
+
+// MessageOf returns the Message carried by an event from Client.Subscribe.
+func MessageOf(event rcon.Event) (Message, bool) {
+	msg, ok := event.Data.(Message)
+	return msg, ok
+}
+
+// TypeFilter accepts events carrying messages of the given types.
+func TypeFilter(types ...MessageType) rcon.EventFilter {
+	return func(event rcon.Event) bool {
+		msg, ok := MessageOf(event)
+		return ok && slices.Contains(types, msg.Type)
+	}
+}
+
+// Client is a WebRCON connection, safe for concurrent use like rcon.Client.
+type Client struct {
+	Address string
+	// Name identifies the client in the server's logs
+	Name string
+
+	ws      *websocket.Conn
+	nextId  atomic.Int32
+	mu      sync.Mutex
+	pending map[int]chan Message
+	events  *rcon.EventHub
+
+	closeOnce sync.Once
+	closed    atomic.Bool
+	done      chan struct{}
+	err       error
+}
+
+// Dial connects to ws://address/password, the password is checked during the handshake.
+func Dial(ctx context.Context, address string, password string) (*Client, error) {
+	ws, err := websocket.Dial(ctx, (&url.URL{Scheme: "ws", Host: address, Path: "/" + password}).String())
+	if err != nil {
+		return nil, err
+	}
+	return NewFromConn(address, ws), nil
+}
+
+// NewFromConn builds a client on an established websocket and starts reading from it.
+func NewFromConn(address string, ws *websocket.Conn) *Client {
+	client := &Client{
+		Address: address,
+		Name:    DefaultName,
+		ws:      ws,
+		pending: make(map[int]chan Message),
+		events:  &rcon.EventHub{},
+		done:    make(chan struct{}),
+	}
+	// Rust uses small identifiers for its own output, keep clear of them
+	client.nextId.Store(1000)
+	go client.readLoop()
+	return client
+}
+
+// Execute runs cmd and returns the body of the message answering it.
+func (src *Client) Execute(ctx context.Context, cmd string) (string, error) {
+	msg, err := src.ExecuteMessage(ctx, cmd)
+	return msg.Message, err
+}
+
+// ExecuteMulti is Execute, WebRCON answers in a single message. It lets the client stand in
+// wherever an rcon.Client's ExecuteMulti is expected.
+func (src *Client) ExecuteMulti(ctx context.Context, cmd string) (string, error) {
+	return src.Execute(ctx, cmd)
+}
+
+// ExecuteMessage is Execute returning the whole message, e.g. to inspect its Type.
+func (src *Client) ExecuteMessage(ctx context.Context, cmd string) (Message, error) {
+	id := int(src.nextId.Add(1))
+	reply := make(chan Message, 1)
+	src.mu.Lock()
+	src.pending[id] = reply
+	src.mu.Unlock()
+	defer func() {
+		src.mu.Lock()
+		delete(src.pending, id)
+		src.mu.Unlock()
+	}()
+
+	body, err := json.Marshal(request{Identifier: id, Message: cmd, Name: src.Name})
+	if err != nil {
+		return Message{}, err
+	}
+	if err := src.ws.WriteMessage(websocket.OpText, body); err != nil {
+		return Message{}, errors.Join(rcon.ErrWriteFailed, err)
+	}
+	select {
+	case msg := <-reply:
+		return msg, nil
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	case <-src.done:
+		return Message{}, src.err
+	}
+}
+
+// Subscribe returns unsolicited messages (console output, chat, warnings) as rcon events,
+// use MessageOf to get the typed Message and TypeFilter to pick types.
+// See rcon.Client.Subscribe for the options.
+func (src *Client) Subscribe(filter rcon.EventFilter, opts ...rcon.SubscribeOption) (<-chan rcon.Event, *rcon.Subscription) {
+	return src.events.Subscribe(filter, opts...)
+}
+
+// Done is closed once the connection ends, after which Err reports why.
+func (src *Client) Done() <-chan struct{} {
+	return src.done
+}
+
+func (src *Client) Err() error {
+	select {
+	case <-src.done:
+		return src.err
+	default:
+		return nil
+	}
+}
+
+func (src *Client) Close() error {
+	src.closed.Store(true)
+	return src.ws.Close()
+}
+
+func (src *Client) readLoop() {
+	for {
+		opcode, data, err := src.ws.ReadMessage()
+		if err != nil {
+			src.finish(err)
+			return
+		}
+		if opcode != websocket.OpText {
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			logger.Debug.Printf("webrcon: dropping malformed message from %v: %v", src.Address, err)
+			continue
+		}
+		src.dispatch(msg)
+	}
+}
+
+func (src *Client) dispatch(msg Message) {
+	if msg.Identifier > 0 {
+		src.mu.Lock()
+		reply, ok := src.pending[msg.Identifier]
+		src.mu.Unlock()
+		if ok {
+			select {
+			case reply <- msg:
+				return
+			default:
+				// the command already has its answer, treat extra output as unsolicited
+			}
+		}
+	}
+	src.events.Publish(rcon.Event{
+		Time:   time.Now(),
+		Packet: packet.New(int32(msg.Identifier), packet.SERVERDATA_RESPONSE_VALUE, []byte(msg.Message)),
+		Kind:   rcon.EventBroadcast,
+		Data:   msg,
+	})
+}
+
+func (src *Client) finish(err error) {
+	src.closeOnce.Do(func() {
+		if src.closed.Load() {
+			err = ErrClientClosed
+		}
+		logger.Debug.Printf("webrcon: connection to %v ended: %v", src.Address, err)
+		src.err = err
+		src.ws.Close()
+		close(src.done)
+		src.events.Close(err)
+	})
+}
@@ -0,0 +1,232 @@
+package webrcon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/UltimateForm/tcprcon/internal/websocket"
+	"github.com/UltimateForm/tcprcon/pkg/rcon"
+)
+
+// fakeServer mimics a Rust server's WebRCON endpoint
+type fakeServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	conns []*websocket.Conn
+	names []string
+}
+
+func newFakeServer(t *testing.T, password string) *fakeServer {
+	t.Helper()
+	srv := &fakeServer{}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+password {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		ws, err := websocket.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		srv.mu.Lock()
+		srv.conns = append(srv.conns, ws)
+		srv.mu.Unlock()
+		srv.serve(ws)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func (src *fakeServer) send(ws *websocket.Conn, msg Message) {
+	data, _ := json.Marshal(msg)
+	ws.WriteMessage(websocket.OpText, data)
+}
+
+func (src *fakeServer) serve(ws *websocket.Conn) {
+	defer ws.Close()
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req request
+		if err := json.Unmarshal(data, &req); err != nil {
+			return
+		}
+		src.mu.Lock()
+		src.names = append(src.names, req.Name)
+		src.mu.Unlock()
+		switch {
+		case req.Message == "silent":
+		case strings.HasPrefix(req.Message, "say "):
+			chat, _ := json.Marshal(ChatMessage{Message: strings.TrimPrefix(req.Message, "say "), Username: "SERVER", UserId: "0", Time: 1700000000})
+			src.send(ws, Message{Identifier: -1, Message: string(chat), Type: MessageChat})
+			src.send(ws, Message{Identifier: req.Identifier, Message: "", Type: MessageGeneric})
+		default:
+			src.send(ws, Message{Identifier: req.Identifier, Message: "echo " + req.Message, Type: MessageGeneric})
+		}
+	}
+}
+
+func (src *fakeServer) broadcast(msg Message) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	for _, ws := range src.conns {
+		src.send(ws, msg)
+	}
+}
+
+func (src *fakeServer) address() string {
+	return strings.TrimPrefix(src.URL, "http://")
+}
+
+func dial(t *testing.T, srv *fakeServer, password string) *Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := Dial(ctx, srv.address(), password)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestDialWrongPassword(t *testing.T) {
+	srv := newFakeServer(t, "secret")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := Dial(ctx, srv.address(), "wrong"); !errors.Is(err, websocket.ErrHandshake) {
+		t.Fatalf("expected ErrHandshake, got %v", err)
+	}
+}
+
+func TestExecuteConcurrent(t *testing.T) {
+	srv := newFakeServer(t, "secret")
+	client := dial(t, srv, "secret")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, cmd := range []string{"status", "serverinfo", "playerlist", "env.time"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, err := client.Execute(ctx, cmd)
+			if err != nil {
+				t.Errorf("Execute(%q) failed: %v", cmd, err)
+				return
+			}
+			if response != "echo "+cmd {
+				t.Errorf("response mismatch: got %q want %q", response, "echo "+cmd)
+			}
+		}()
+	}
+	wg.Wait()
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for _, name := range srv.names {
+		if name != DefaultName {
+			t.Fatalf("name mismatch: got %q want %q", name, DefaultName)
+		}
+	}
+}
+
+func TestSubscribeTypedMessages(t *testing.T) {
+	srv := newFakeServer(t, "secret")
+	client := dial(t, srv, "secret")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	chat, _ := client.Subscribe(TypeFilter(MessageChat))
+	warnings, _ := client.Subscribe(TypeFilter(MessageWarning))
+
+	if _, err := client.Execute(ctx, "say hello"); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	srv.broadcast(Message{Identifier: 0, Message: "low disk space", Type: MessageWarning})
+
+	select {
+	case event := <-chat:
+		msg, ok := MessageOf(event)
+		if !ok {
+			t.Fatal("expected the event to carry a Message")
+		}
+		body, err := msg.Chat()
+		if err != nil {
+			t.Fatalf("Chat failed: %v", err)
+		}
+		if body.Message != "hello" || body.Username != "SERVER" {
+			t.Fatalf("chat mismatch: got %+v", body)
+		}
+		if event.Kind != rcon.EventBroadcast {
+			t.Fatalf("kind mismatch: got %v want %v", event.Kind, rcon.EventBroadcast)
+		}
+	case <-ctx.Done():
+		t.Fatal("chat message was not delivered")
+	}
+	select {
+	case event := <-warnings:
+		if event.Packet.BodyStr() != "low disk space" {
+			t.Fatalf("warning mismatch: got %q", event.Packet.BodyStr())
+		}
+	case <-ctx.Done():
+		t.Fatal("warning was not delivered")
+	}
+	select {
+	case event := <-chat:
+		t.Fatalf("unexpected event %q", event.Packet.BodyStr())
+	default:
+	}
+}
+
+func TestChatRejectsOtherTypes(t *testing.T) {
+	if _, err := (Message{Type: MessageGeneric, Message: "{}"}).Chat(); !errors.Is(err, ErrNotChat) {
+		t.Fatalf("expected ErrNotChat, got %v", err)
+	}
+}
+
+func TestExecuteFailsWhenServerCloses(t *testing.T) {
+	srv := newFakeServer(t, "secret")
+	client := dial(t, srv, "secret")
+	events, _ := client.Subscribe(nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result := make(chan error, 1)
+	go func() {
+		_, err := client.Execute(ctx, "silent")
+		result <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	srv.mu.Lock()
+	for _, ws := range srv.conns {
+		ws.Close()
+	}
+	srv.mu.Unlock()
+	select {
+	case err := <-result:
+		if !errors.Is(err, websocket.ErrClosed) {
+			t.Fatalf("expected ErrClosed, got %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("Execute did not return after the server closed")
+	}
+	if _, ok := <-events; ok {
+		t.Fatal("expected subscription to close with the connection")
+	}
+}
+
+func TestClose(t *testing.T) {
+	srv := newFakeServer(t, "secret")
+	client := dial(t, srv, "secret")
+	client.Close()
+	<-client.Done()
+	if !errors.Is(client.Err(), ErrClientClosed) {
+		t.Fatalf("expected ErrClientClosed, got %v", client.Err())
+	}
+}